@@ -171,6 +171,65 @@ func TestRunTask(t *testing.T) {
 		})
 	})
 
+	t.Run("heartbeats while the task runs", func(t *testing.T) {
+		ctx := testcontext.Background()
+		runnerAPI := fakerunnerapi.New(ctx, []fakerunnerapi.Task{
+			{
+				Token:      "testtoken",
+				Allocation: "testallocation",
+			},
+		})
+		s := httptest.NewServer(runnerAPI)
+		t.Cleanup(s.Close)
+
+		heartbeatConfig := fmt.Sprintf(`
+	{
+		"cmd": [],
+		"token": "testtoken",
+		"task_agent_path": "%v",
+		"runner_api_base_url": "%v",
+		"allocation": "testallocation",
+		"max_run_time": 60000000000,
+		"heartbeat_interval": 500000000
+	}`, strings.ReplaceAll(taskAgentBinary, `\`, `\\`), s.URL)
+
+		r := runner.New(
+			"CIRCLECI_GOAT_SHUTDOWN_DELAY=10s",
+			"CIRCLECI_GOAT_CONFIG="+heartbeatConfig,
+			"CIRCLECI_GOAT_HEALTH_CHECK_ADDR=:7624",
+		)
+		res, err := r.Start(orchestratorTestBinaryRunTask)
+		assert.NilError(t, err)
+		defer func() { t.Log(res.Logs()) }()
+
+		t.Run("Run task", func(t *testing.T) {
+			select {
+			case err = <-res.Wait():
+				assert.NilError(t, err)
+			case <-time.After(time.Second * 40):
+				assert.NilError(t, res.Stop())
+				t.Fatal(t, "timeout before process stopped")
+			}
+		})
+
+		t.Run("Heartbeats sent", func(t *testing.T) {
+			// The fake task agent runs for around 4 seconds
+			heartbeats := runnerAPI.Heartbeats()
+			assert.Assert(t, len(heartbeats) >= 5, "got %d heartbeats", len(heartbeats))
+
+			for i, hb := range heartbeats {
+				assert.Check(t, cmp.Equal(hb.Allocation, "testallocation"))
+				assert.Check(t, hb.Correlation != "", "expected a correlation ID")
+				if i > 0 {
+					gap := time.Duration(hb.TimestampMilli-heartbeats[i-1].TimestampMilli) * time.Millisecond
+					assert.Check(t, gap >= 400*time.Millisecond && gap <= 1500*time.Millisecond,
+						"unexpected heartbeat cadence: %s", gap)
+				}
+			}
+			assert.Check(t, cmp.Equal(heartbeats[len(heartbeats)-1].Phase, "running"))
+		})
+	})
+
 	t.Run("task-agent fails to start", func(t *testing.T) {
 		ctx := testcontext.Background()
 		runnerAPI := fakerunnerapi.New(ctx, []fakerunnerapi.Task{
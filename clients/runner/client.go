@@ -2,6 +2,7 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -19,6 +20,7 @@ var ErrExhaustedTaskRetries = o11y.NewWarning("exhausted all task retries")
 
 type Client struct {
 	client *httpclient.Client
+	info   Info
 }
 
 type ClientConfig struct {
@@ -56,19 +58,28 @@ func NewClient(c ClientConfig) *Client {
 		cfg.Tracer = c.Tracer
 	}
 
-	return &Client{httpclient.New(cfg)}
+	return &Client{client: httpclient.New(cfg), info: c.Info}
+}
+
+// IsRejected is true if the runner API rejected a request, so resending it won't succeed
+func IsRejected(err error) bool {
+	return errors.Is(err, ErrExhaustedTaskRetries) || httpclient.IsRequestProblem(err)
 }
 
 type taskUnclaim struct {
-	ID    string `json:"task_id" binding:"required"`
-	Token string `json:"task_token" binding:"required"`
+	ID             string `json:"task_id" binding:"required"`
+	Token          string `json:"task_token" binding:"required"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
-func (c *Client) UnclaimTask(ctx context.Context, id string, token secret.String) error {
+// UnclaimTask returns the task to the queue to be retried.
+// The idempotency key, if set, lets the runner API dedupe an unclaim that is sent more than once.
+func (c *Client) UnclaimTask(ctx context.Context, id string, token secret.String, idempotencyKey string) error {
 	r := httpclient.NewRequest("POST", "/api/v3/runner/unclaim",
 		httpclient.Body(&taskUnclaim{
-			ID:    id,
-			Token: token.Raw(),
+			ID:             id,
+			Token:          token.Raw(),
+			IdempotencyKey: idempotencyKey,
 		}))
 
 	err := c.call(ctx, r)
@@ -89,19 +100,74 @@ type taskEvent struct {
 	Allocation     string `json:"allocation"`
 	TimestampMilli int64  `json:"timestamp"`
 	Message        []byte `json:"message"`
+	Code           string `json:"code,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
-func (c *Client) FailTask(ctx context.Context, timestamp time.Time, allocation, message string) error {
+// FailTask fails the task with the message. The code, if set, is a stable identifier for the kind of failure.
+// The idempotency key, if set, lets the runner API dedupe a fail event that is sent more than once.
+func (c *Client) FailTask(ctx context.Context, timestamp time.Time,
+	allocation, code, message, idempotencyKey string) error {
 	r := httpclient.NewRequest("POST", "/api/v2/task/event/fail",
 		httpclient.Body(&taskEvent{
 			Allocation:     allocation,
 			TimestampMilli: timestamp.UnixMilli(),
 			Message:        []byte(regexMatchHTMLSpecialChars.ReplaceAllString(message, "")),
+			Code:           code,
+			IdempotencyKey: idempotencyKey,
 		}))
 
 	return c.call(ctx, r)
 }
 
+type heartbeat struct {
+	Allocation     string `json:"allocation"`
+	TimestampMilli int64  `json:"timestamp"`
+	Phase          string `json:"phase"`
+	Correlation    string `json:"correlation"`
+}
+
+// Heartbeat reports the task is still alive and what phase it is in.
+// It isn't retried, since a failed heartbeat is superseded by the next one.
+func (c *Client) Heartbeat(ctx context.Context, timestamp time.Time, allocation, phase string) error {
+	r := httpclient.NewRequest("POST", "/api/v2/task/event/heartbeat",
+		httpclient.Body(&heartbeat{
+			Allocation:     allocation,
+			TimestampMilli: timestamp.UnixMilli(),
+			Phase:          phase,
+			Correlation:    c.info.Correlation,
+		}),
+		httpclient.NoRetry(),
+		httpclient.Timeout(10*time.Second),
+	)
+
+	return c.call(ctx, r)
+}
+
+type lifecycleEvent struct {
+	Allocation     string `json:"allocation"`
+	TimestampMilli int64  `json:"timestamp"`
+	Event          string `json:"event"`
+	Correlation    string `json:"correlation"`
+}
+
+// LifecycleEvent reports the orchestrator reached a phase of the task, such as the task agent starting.
+// Like heartbeats, it isn't retried, since the events are only informational.
+func (c *Client) LifecycleEvent(ctx context.Context, timestamp time.Time, allocation, event string) error {
+	r := httpclient.NewRequest("POST", "/api/v2/task/event/lifecycle",
+		httpclient.Body(&lifecycleEvent{
+			Allocation:     allocation,
+			TimestampMilli: timestamp.UnixMilli(),
+			Event:          event,
+			Correlation:    c.info.Correlation,
+		}),
+		httpclient.NoRetry(),
+		httpclient.Timeout(10*time.Second),
+	)
+
+	return c.call(ctx, r)
+}
+
 func (c *Client) call(ctx context.Context, r httpclient.Request) error {
 	err := c.client.Call(ctx, r)
 	if err != nil && !httpclient.IsNoContent(err) {
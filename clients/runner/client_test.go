@@ -21,8 +21,9 @@ import (
 
 func TestClient_UnclaimTask(t *testing.T) {
 	type unclaim struct {
-		ID    string `json:"task_id"`
-		Token string `json:"task_token"`
+		ID             string `json:"task_id"`
+		Token          string `json:"task_token"`
+		IdempotencyKey string `json:"idempotency_key,omitempty"`
 	}
 
 	var (
@@ -41,8 +42,9 @@ func TestClient_UnclaimTask(t *testing.T) {
 	tests := []struct {
 		name string
 
-		taskID string
-		token  secret.String
+		taskID         string
+		token          secret.String
+		idempotencyKey string
 
 		wantRequests []httprecorder.Request
 		wantError    string
@@ -66,6 +68,27 @@ func TestClient_UnclaimTask(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "with idempotency key",
+
+			taskID:         goodTask.ID,
+			token:          goodTask.Token,
+			idempotencyKey: "key",
+			wantRequests: []httprecorder.Request{
+				{
+					Method: "POST",
+					URL:    url.URL{Path: "/api/v3/runner/unclaim"},
+					Header: http.Header{"Accept": {"application/json; charset=utf-8"}, "Accept-Encoding": {"gzip"},
+						"Content-Type": {"application/json; charset=utf-8"},
+					},
+					Body: jsonMustMarshal(t, unclaim{
+						ID:             goodTask.ID,
+						Token:          goodTask.Token.Raw(),
+						IdempotencyKey: "key",
+					}),
+				},
+			},
+		},
 		{
 			name: "exhausted all retries",
 
@@ -123,7 +146,7 @@ func TestClient_UnclaimTask(t *testing.T) {
 				Info:      Info{},
 			})
 
-			err := c.UnclaimTask(ctx, tt.taskID, tt.token)
+			err := c.UnclaimTask(ctx, tt.taskID, tt.token, tt.idempotencyKey)
 
 			if tt.wantError == "" {
 				assert.NilError(t, err)
@@ -146,10 +169,12 @@ func TestClient_FailTask(t *testing.T) {
 	tests := []struct {
 		name string
 
-		token      secret.String
-		timestamp  time.Time
-		message    string
-		allocation string
+		token          secret.String
+		timestamp      time.Time
+		message        string
+		allocation     string
+		code           string
+		idempotencyKey string
 
 		wantRequests []httprecorder.Request
 		wantError    string
@@ -183,6 +208,41 @@ func TestClient_FailTask(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:           "with code and idempotency key",
+			token:          goodTask.Token,
+			timestamp:      time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC),
+			allocation:     goodTask.Allocation,
+			message:        "error",
+			code:           "OOM_KILLED",
+			idempotencyKey: "key",
+
+			wantRequests: []httprecorder.Request{
+				{
+					Method: "POST",
+					URL:    url.URL{Path: "/api/v2/task/event/fail"},
+					Header: http.Header{
+						"Accept":          {"application/json; charset=utf-8"},
+						"Accept-Encoding": {"gzip"},
+						"Authorization":   {"Bearer testtoken"},
+						"Content-Type":    {"application/json; charset=utf-8"},
+					},
+					Body: jsonMustMarshal(t, struct {
+						Allocation     string `json:"allocation"`
+						TimestampMilli int64  `json:"timestamp"`
+						Message        []byte `json:"message"`
+						Code           string `json:"code"`
+						IdempotencyKey string `json:"idempotency_key"`
+					}{
+						Allocation:     "alloc",
+						TimestampMilli: 1257894000000,
+						Message:        []byte("error"),
+						Code:           "OOM_KILLED",
+						IdempotencyKey: "key",
+					}),
+				},
+			},
+		},
 		{
 			name:      "not found",
 			token:     "badtoken",
@@ -204,7 +264,7 @@ func TestClient_FailTask(t *testing.T) {
 				Info:      Info{},
 			})
 
-			err := c.FailTask(ctx, tt.timestamp, tt.allocation, tt.message)
+			err := c.FailTask(ctx, tt.timestamp, tt.allocation, tt.code, tt.message, tt.idempotencyKey)
 
 			if tt.wantError == "" {
 				assert.NilError(t, err)
@@ -221,6 +281,117 @@ func TestClient_FailTask(t *testing.T) {
 	}
 }
 
+func TestClient_Heartbeat(t *testing.T) {
+	ctx := testcontext.Background()
+	task := fakerunnerapi.Task{
+		Token:      secret.String("testtoken"),
+		Allocation: "alloc",
+	}
+	runnerAPI := fakerunnerapi.New(ctx, []fakerunnerapi.Task{task})
+	server := httptest.NewServer(runnerAPI)
+	defer server.Close()
+
+	c := NewClient(ClientConfig{
+		BaseURL:   server.URL,
+		AuthToken: task.Token,
+		Info:      Info{Correlation: "ccita-pod"},
+	})
+
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	err := c.Heartbeat(ctx, timestamp, "alloc", "running")
+	assert.NilError(t, err)
+
+	assert.Check(t, cmp.DeepEqual(runnerAPI.Heartbeats(), []fakerunnerapi.Heartbeat{
+		{
+			Allocation:     "alloc",
+			TimestampMilli: 1257894000000,
+			Phase:          "running",
+			Correlation:    "ccita-pod",
+		},
+	}))
+
+	err = c.Heartbeat(ctx, timestamp, "wrong-alloc", "running")
+	assert.Check(t, cmp.ErrorContains(err, "404 (Not Found)"))
+}
+
+func TestClient_LifecycleEvent(t *testing.T) {
+	ctx := testcontext.Background()
+	task := fakerunnerapi.Task{
+		Token:      secret.String("testtoken"),
+		Allocation: "alloc",
+	}
+	runnerAPI := fakerunnerapi.New(ctx, []fakerunnerapi.Task{task})
+	server := httptest.NewServer(runnerAPI)
+	defer server.Close()
+
+	c := NewClient(ClientConfig{
+		BaseURL:   server.URL,
+		AuthToken: task.Token,
+		Info:      Info{Correlation: "ccita-pod"},
+	})
+
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	err := c.LifecycleEvent(ctx, timestamp, "alloc", "agent-started")
+	assert.NilError(t, err)
+
+	assert.Check(t, cmp.DeepEqual(runnerAPI.LifecycleEvents(), []fakerunnerapi.LifecycleEvent{
+		{
+			Allocation:     "alloc",
+			TimestampMilli: 1257894000000,
+			Event:          "agent-started",
+			Correlation:    "ccita-pod",
+		},
+	}))
+}
+
+func TestClient_retries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+
+		wantAttempts int
+		wantError    string
+	}{
+		{
+			name:         "transient server errors are retried",
+			statuses:     []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK},
+			wantAttempts: 3,
+		},
+		{
+			name:         "conflicts are never retried",
+			statuses:     []int{http.StatusConflict, http.StatusOK},
+			wantAttempts: 1,
+			wantError:    ErrExhaustedTaskRetries.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testcontext.Background()
+
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.statuses[min(attempts, len(tt.statuses)-1)])
+				attempts++
+			}))
+			defer server.Close()
+
+			c := NewClient(ClientConfig{
+				BaseURL:   server.URL,
+				AuthToken: "testtoken",
+			})
+
+			err := c.UnclaimTask(ctx, "id", "testtoken", "")
+			if tt.wantError == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.Check(t, cmp.ErrorContains(err, tt.wantError))
+			}
+			assert.Check(t, cmp.Equal(attempts, tt.wantAttempts))
+		})
+	}
+}
+
 func jsonMustMarshal(t *testing.T, v interface{}) []byte {
 	t.Helper()
 
@@ -39,6 +39,16 @@ func TestHelp(t *testing.T) {
 			cli:          &cli.RunTask,
 			wantFilename: "run-task.txt",
 		},
+		{
+			name:         "check signal-ready command help",
+			cli:          &cli.SignalReady,
+			wantFilename: "signal-ready.txt",
+		},
+		{
+			name:         "check wait-ready command help",
+			cli:          &cli.WaitReady,
+			wantFilename: "wait-ready.txt",
+		},
 	}
 
 	for _, tt := range tests {
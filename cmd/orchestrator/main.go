@@ -22,6 +22,7 @@ import (
 	initialize "github.com/circleci/runner-init/init"
 	"github.com/circleci/runner-init/task"
 	"github.com/circleci/runner-init/task/entrypoint"
+	"github.com/circleci/runner-init/task/readiness"
 	"github.com/circleci/runner-init/task/taskerrors"
 )
 
@@ -32,12 +33,31 @@ type cli struct {
 	Override overrideCmd `cmd:"" name:"override"`
 	RunTask  runTaskCmd  `cmd:"" name:"run-task"`
 
+	SignalReady signalReadyCmd `cmd:"" name:"signal-ready" help:"Signal that a service container is ready."`
+	WaitReady   waitReadyCmd   `cmd:"" name:"wait-ready" help:"Wait for service containers to signal they are ready."`
+
 	ShutdownDelay time.Duration `default:"0s" help:"Delay shutdown by this amount."`
 }
 
 type initCmd struct {
 	Source      string `arg:"" env:"SOURCE" type:"path" default:"/" help:"Path where to copy the agent binaries from."`
 	Destination string `arg:"" env:"DESTINATION" type:"path" default:"/opt/circleci/bin" help:"Path where to copy the agent binaries to."`
+	Manifest    string `env:"MANIFEST" type:"path" help:"Path to a JSON manifest listing the files to copy, their destination names, modes and aliases. Defaults to the orchestrator and task agent binaries."`
+
+	VerifySignatures bool   `env:"VERIFY_SIGNATURES" help:"Verify the detached cosign signature (<file>.bundle or <file>.sig) of each file before copying it, failing if it is missing or invalid."`
+	PublicKey        string `env:"PUBLIC_KEY" type:"path" help:"Path to the PEM-encoded public key to verify signatures with. Defaults to the runner-init signing key."`
+	SelfTest         bool   `env:"SELF_TEST" help:"Execute the installed binaries with their version arguments after copying, failing if they aren't executable on this node."`
+}
+
+type signalReadyCmd struct {
+	Name         string `arg:"" optional:"" default:"ready" help:"Name of the readiness marker, such as the service container name."`
+	ReadinessDir string `type:"path" default:"/opt/circleci/status" help:"Path to the readiness directory on the volume shared with the task container."`
+}
+
+type waitReadyCmd struct {
+	Names        []string      `arg:"" optional:"" default:"ready" help:"Names of the readiness markers to wait for."`
+	ReadinessDir string        `type:"path" default:"/opt/circleci/status" help:"Path to the readiness directory on the volume shared with the task container."`
+	Timeout      time.Duration `default:"10m" help:"How long to wait for the readiness markers."`
 }
 
 type overrideCmd struct {
@@ -91,10 +111,13 @@ func run(version, date string) (err error) {
 	case "init":
 		fallthrough
 	case "init <source> <destination>":
-		c := cli.Init
+		c, err := initConfig(cli.Init)
+		if err != nil {
+			return err
+		}
 		sys.AddService(func(_ context.Context) error {
 			defer cancel()
-			return initialize.Run(ctx, c.Source, c.Destination)
+			return initialize.Run(ctx, c)
 		})
 
 	case "override":
@@ -104,6 +127,24 @@ func run(version, date string) (err error) {
 			return ep.Run(ctx)
 		})
 
+	case "signal-ready", "signal-ready <name>":
+		c := cli.SignalReady
+		sys.AddService(func(_ context.Context) error {
+			defer cancel()
+			return readiness.Signal(c.ReadinessDir, c.Name)
+		})
+
+	case "wait-ready", "wait-ready <names>":
+		c := cli.WaitReady
+		sys.AddService(func(ctx context.Context) error {
+			defer cancel()
+			ctx, cancelWait := context.WithTimeout(ctx, c.Timeout)
+			defer cancelWait()
+			return readiness.Wait(ctx, c.ReadinessDir, c.Names, func(name string) {
+				o11y.Log(ctx, "readiness marker signalled", o11y.Field("name", name))
+			})
+		})
+
 	case "run-task":
 		orchestrator, err := runSetup(ctx, cli, version, sys)
 		if err != nil {
@@ -119,6 +160,33 @@ func run(version, date string) (err error) {
 	return sys.Run(ctx, cli.ShutdownDelay)
 }
 
+func initConfig(c initCmd) (initialize.Config, error) {
+	manifest := initialize.DefaultManifest()
+	if c.Manifest != "" {
+		var err error
+		if manifest, err = initialize.LoadManifest(c.Manifest); err != nil {
+			return initialize.Config{}, err
+		}
+	}
+
+	var publicKey []byte
+	if c.PublicKey != "" {
+		var err error
+		if publicKey, err = os.ReadFile(c.PublicKey); err != nil { //#nosec:G304 // this is trusted input
+			return initialize.Config{}, fmt.Errorf("failed to read public key: %w", err)
+		}
+	}
+
+	return initialize.Config{
+		Source:           c.Source,
+		Destination:      c.Destination,
+		Manifest:         manifest,
+		VerifySignatures: c.VerifySignatures,
+		PublicKey:        publicKey,
+		SelfTest:         c.SelfTest,
+	}, nil
+}
+
 func runSetup(ctx context.Context, cli cli, version string, sys *system.System) (Runner, error) {
 	c := cli.RunTask
 	// Strip the orchestrator configuration from the environment
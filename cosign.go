@@ -0,0 +1,10 @@
+package runnerinit
+
+import (
+	_ "embed"
+)
+
+// CosignPublicKey is the public key for verifying the signatures of runner-init images and binaries
+//
+//go:embed cosign.pub
+var CosignPublicKey []byte
@@ -0,0 +1,97 @@
+package init
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumsFile is the digest manifest shipped next to the binaries in the init image.
+// It uses the same format as the output of `sha256sum`.
+const checksumsFile = "SHA256SUMS"
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+type checksums map[string]string
+
+// loadChecksums reads the digest manifest from the source directory.
+// A nil map is returned if the image doesn't ship a manifest.
+func loadChecksums(srcDir string) (checksums, error) {
+	f, err := os.Open(filepath.Join(srcDir, checksumsFile)) //#nosec:G304 // this is trusted input
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	sums := checksums{}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+
+		digest, name, ok := strings.Cut(line, " ")
+		if !ok || len(digest) != sha256.Size*2 {
+			return nil, fmt.Errorf("malformed line %d in %s", n, checksumsFile)
+		}
+		// A leading asterisk on the filename indicates binary mode, which is irrelevant here
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+
+		sums[name] = strings.ToLower(digest)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", checksumsFile, err)
+	}
+
+	return sums, nil
+}
+
+// expected returns the digest the named binary is expected to have.
+// An empty string is returned if there is no manifest to check against.
+func (c checksums) expected(name string) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+
+	digest, ok := c[name]
+	if !ok {
+		return "", fmt.Errorf("no checksum for %s in %s", name, checksumsFile)
+	}
+	return digest, nil
+}
+
+func verifyChecksum(name, want, got string) error {
+	if want != got {
+		return fmt.Errorf("%w for %s: expected sha256 %s, but got %s", ErrChecksumMismatch, name, want, got)
+	}
+	return nil
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path) //#nosec:G304 // this is trusted input
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package init
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// syncDir flushes the directory entries, so renames into the directory survive a crash
+func syncDir(dir string) (err error) {
+	d, err := os.Open(dir) //#nosec:G304 // this is trusted input
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, d.Close())
+	}()
+
+	return d.Sync()
+}
+
+func statVolume(dir string) (volumeInfo, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return volumeInfo{}, err
+	}
+
+	return volumeInfo{
+		//nolint:gosec // G115: block counts and sizes are never negative
+		available: st.Bavail * uint64(st.Bsize),
+		readOnly:  st.Flags&unix.ST_RDONLY != 0,
+		noExec:    st.Flags&unix.ST_NOEXEC != 0,
+	}, nil
+}
@@ -0,0 +1,38 @@
+package init
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// syncDir is a no-op on Windows, since directories can't be opened for syncing
+func syncDir(string) error {
+	return nil
+}
+
+func statVolume(dir string) (volumeInfo, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return volumeInfo{}, err
+	}
+
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, nil, nil); err != nil {
+		return volumeInfo{}, err
+	}
+
+	root := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumePathName(path, &root[0], uint32(len(root))); err != nil {
+		return volumeInfo{}, err
+	}
+
+	var flags uint32
+	if err := windows.GetVolumeInformation(&root[0], nil, 0, nil, nil, &flags, nil, 0); err != nil {
+		return volumeInfo{}, err
+	}
+
+	// There is no equivalent of a noexec mount on Windows
+	return volumeInfo{
+		available: available,
+		readOnly:  flags&windows.FILE_READ_ONLY_VOLUME != 0,
+	}, nil
+}
@@ -2,7 +2,10 @@ package init
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -11,77 +14,311 @@ import (
 	"github.com/circleci/ex/o11y"
 )
 
-// Run function performs the copying of the orchestrator and task-agent binaries
-func Run(ctx context.Context, srcDir, destDir string) (err error) {
+// tmpPattern is the pattern for the temporary files binaries are written to before being renamed into place
+const tmpPattern = ".*.tmp-*"
+
+type Config struct {
+	// Source is the directory to copy the files from
+	Source string
+	// Destination is the directory to copy the files to, which is usually on a volume shared with the task container
+	Destination string
+	// Manifest lists the files to copy
+	Manifest Manifest
+	// VerifySignatures enables verification of the detached signature of each file before it is copied
+	VerifySignatures bool
+	// PublicKey is the PEM-encoded key to verify signatures with, which defaults to the runner-init signing key
+	PublicKey []byte
+	// SelfTest enables executing the installed binaries with their version arguments after they are copied
+	SelfTest bool
+}
+
+// Run function performs the copying of the files in the manifest, which by default are the orchestrator and
+// task-agent binaries
+func Run(ctx context.Context, c Config) (err error) {
 	ctx, span := o11y.StartSpan(ctx, "orchestrator: init")
 	defer o11y.End(span, &err)
 
 	span.RecordMetric(o11y.Timing("init.duration"))
+	span.AddField("files", len(c.Manifest.Files))
 
-	// Copy the orchestrator binary
-	orchestratorSrc := filepath.Join(srcDir, binOrchestrator)
-	orchestratorDest := filepath.Join(destDir, binOrchestrator)
-	if err := copyFile(ctx, orchestratorSrc, orchestratorDest); err != nil {
+	sums, err := loadChecksums(c.Source)
+	if err != nil {
 		return err
 	}
+	span.AddField("checksums_verified", sums != nil)
 
-	// Copy the task agent binary
-	agentSrc := filepath.Join(srcDir, binCircleciAgent)
-	agentDest := filepath.Join(destDir, binCircleciAgent)
-	if err := copyFile(ctx, agentSrc, agentDest); err != nil {
+	var v *verifier
+	if c.VerifySignatures {
+		if v, err = newVerifier(c.PublicKey); err != nil {
+			return err
+		}
+	}
+	span.AddField("signatures_verified", v != nil)
+
+	// Check the volume first, so an unusable volume isn't reported as a failure to clean up
+	if err := preflight(ctx, c); err != nil {
 		return err
 	}
 
-	circleciDest := filepath.Join(destDir, binCircleci)
-	if runtime.GOOS != "windows" {
-		// Create symbolic link from "circleci-agent" to "circleci"
-		if err := os.Symlink(agentDest, circleciDest); err != nil {
-			return err
-		}
-	} else {
-		// We copy the binary instead of creating a symlink to `circleci` as we do on Linux,
-		// since we do not have the necessary privileges to create symlinks to the shared volume on Windows.
-		if err := copyFile(ctx, agentSrc, circleciDest); err != nil {
+	// Clean up after any previous attempt that was interrupted part way through
+	if err := removeStaleTempFiles(ctx, c.Destination); err != nil {
+		return err
+	}
+
+	var bytesCopied int64
+	defer func() {
+		span.AddField("bytes_copied", bytesCopied)
+		span.RecordMetric(o11y.Count("init.copy.bytes", "bytes_copied", nil))
+	}()
+
+	for _, f := range c.Manifest.Files {
+		n, err := installFile(ctx, c, f, sums, v)
+		bytesCopied += n
+		if err != nil {
 			return err
 		}
 	}
 
+	if err := syncDir(c.Destination); err != nil {
+		return err
+	}
+
+	if c.SelfTest {
+		return selfTest(ctx, c)
+	}
 	return nil
 }
 
-func copyFile(ctx context.Context, srcPath, destPath string) (err error) {
+func installFile(ctx context.Context, c Config, f File, sums checksums, v *verifier) (bytesCopied int64, err error) {
+	src := filepath.Join(c.Source, f.Source)
+	dest := filepath.Join(c.Destination, f.destination())
+
+	want, err := sums.expected(f.Source)
+	if err != nil {
+		return 0, err
+	}
+
+	if v != nil {
+		// Verify the signature before anything is written to the destination, then make sure
+		// the copy has the same digest as what was verified
+		verified, err := v.verify(ctx, src)
+		if err != nil {
+			return 0, err
+		}
+		if want != "" {
+			if err := verifyChecksum(f.Source, want, verified); err != nil {
+				return 0, err
+			}
+		}
+		want = verified
+	}
+
+	n, err := copyFile(ctx, src, dest, f.Mode, want)
+	bytesCopied += n
+	if err != nil {
+		return bytesCopied, err
+	}
+
+	for _, alias := range f.Aliases {
+		aliasDest := filepath.Join(c.Destination, alias)
+		if runtime.GOOS != "windows" {
+			// Create a symbolic link to the file for the alias (e.g., from "circleci-agent" to "circleci")
+			if err := symlink(dest, aliasDest); err != nil {
+				return bytesCopied, err
+			}
+		} else {
+			// We copy the file instead of creating a symlink as we do on Linux, since we do not have
+			// the necessary privileges to create symlinks to the shared volume on Windows.
+			n, err := copyFile(ctx, src, aliasDest, f.Mode, want)
+			bytesCopied += n
+			if err != nil {
+				return bytesCopied, err
+			}
+		}
+	}
+
+	return bytesCopied, nil
+}
+
+// copyFile copies the binary to a temporary file in the destination directory and then renames it into place.
+// This ensures a partially written binary is never left behind at the destination path,
+// even if the init container is interrupted and restarted. If a digest is wanted, the copy must match it.
+// The copy is skipped if an identical file is already at the destination path.
+func copyFile(ctx context.Context, srcPath, destPath string, mode Mode, want string) (bytesCopied int64, err error) {
 	_, span := o11y.StartSpan(ctx, "orchestrator: init: copy")
 	defer o11y.End(span, &err)
 
-	span.AddField("binary", filepath.Base(srcPath))
+	name := filepath.Base(srcPath)
+	span.AddField("binary", name)
+	span.AddField("destination", filepath.Base(destPath))
 	span.RecordMetric(o11y.Timing("init.copy.duration"))
 
-	closeFile := func(f *os.File) {
-		err = errors.Join(err, f.Close())
-	}
-
 	srcFile, err := os.Open(srcPath) //#nosec:G304 // this is trusted input
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer closeFile(srcFile)
+	defer func() {
+		err = errors.Join(err, srcFile.Close())
+	}()
 
-	// Get the file info to preserve the permissions
 	info, err := srcFile.Stat()
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	// Preserve the permissions of the source, unless overridden
+	perm := os.FileMode(mode)
+	if perm == 0 {
+		perm = info.Mode()
+	}
+
+	skip, err := isUnchanged(srcPath, destPath, info, perm, want)
+	span.AddField("skipped", skip)
+	if err != nil || skip {
+		return 0, err
+	}
+
+	tmpPath, digest, err := writeTempFile(srcFile, destPath, perm)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+	span.AddField("sha256", digest)
+
+	if want != "" {
+		if err := verifyChecksum(name, want, digest); err != nil {
+			return 0, err
+		}
+	}
+
+	// Then verify what actually landed on the destination volume
+	destDigest, err := fileChecksum(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	span.AddField("dest_sha256", destDigest)
+
+	if err := verifyChecksum(name, digest, destDigest); err != nil {
+		return 0, err
+	}
+
+	// Match the modification time of the source, so an unchanged file can be cheaply detected next time
+	if err := os.Chtimes(tmpPath, info.ModTime(), info.ModTime()); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return 0, err
+	}
+
+	span.AddField("bytes_copied", info.Size())
+	return info.Size(), nil
+}
+
+// isUnchanged checks if the destination already has an identical copy of the source,
+// which happens when the destination is a persistent or pre-staged volume rather than an emptyDir.
+// The size, permissions and modification time are compared first, so the digest is only computed on a likely match.
+func isUnchanged(srcPath, destPath string, srcInfo os.FileInfo, perm os.FileMode, want string) (bool, error) {
+	destInfo, err := os.Lstat(destPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
 	}
 
-	//#nosec:G304 // this is trusted output
-	destFile, err := os.OpenFile(destPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if !destInfo.Mode().IsRegular() ||
+		destInfo.Size() != srcInfo.Size() ||
+		!destInfo.ModTime().Equal(srcInfo.ModTime()) ||
+		// Permissions other than read-only aren't meaningful on Windows
+		(runtime.GOOS != "windows" && destInfo.Mode().Perm() != perm.Perm()) {
+		return false, nil
+	}
+
+	if want == "" {
+		if want, err = fileChecksum(srcPath); err != nil {
+			return false, err
+		}
+	}
+
+	got, err := fileChecksum(destPath)
 	if err != nil {
+		return false, err
+	}
+
+	return got == want, nil
+}
+
+// writeTempFile writes the contents of the source to a temporary file next to the destination path,
+// returning the path of the temporary file and the digest of the contents.
+func writeTempFile(src io.Reader, destPath string, mode os.FileMode) (tmpPath, digest string, err error) {
+	tmpFile, err := os.CreateTemp(filepath.Dir(destPath), "."+filepath.Base(destPath)+".tmp-*")
+	if err != nil {
+		return "", "", err
+	}
+	tmpPath = tmpFile.Name()
+
+	defer func() {
+		err = errors.Join(err, tmpFile.Close())
+		if err != nil {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if err := tmpFile.Chmod(mode); err != nil {
+		return "", "", err
+	}
+
+	// Hash the source while copying, so it is only read once
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmpFile, h), src); err != nil {
+		return "", "", err
+	}
+
+	// Make sure the contents are on disk before the file is renamed into place
+	if err := tmpFile.Sync(); err != nil {
+		return "", "", err
+	}
+
+	return tmpPath, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// symlink atomically creates or replaces a symbolic link at the link path
+func symlink(target, link string) error {
+	tmpLink := fmt.Sprintf("%s.tmp-%d", filepath.Join(filepath.Dir(link), "."+filepath.Base(link)), os.Getpid())
+
+	if err := os.Remove(tmpLink); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := os.Symlink(target, tmpLink); err != nil {
 		return err
 	}
-	defer closeFile(destFile)
 
-	if _, err = io.Copy(destFile, srcFile); err != nil {
+	if err := os.Rename(tmpLink, link); err != nil {
+		_ = os.Remove(tmpLink)
 		return err
 	}
 
-	return err
+	return nil
+}
+
+func removeStaleTempFiles(ctx context.Context, destDir string) error {
+	stale, err := filepath.Glob(filepath.Join(destDir, tmpPattern))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range stale {
+		o11y.Log(ctx, "removing stale temporary file from a previous init", o11y.Field("path", path))
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -1,6 +1,15 @@
 package init
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -22,7 +31,7 @@ func TestRun(t *testing.T) {
 	ctx := testcontext.Background()
 
 	t.Run("Copy files and create symlink", func(t *testing.T) {
-		err := Run(ctx, srcDir, destDir)
+		err := Run(ctx, defaultConfig(srcDir, destDir))
 		assert.NilError(t, err)
 
 		assertFileIsCopied(t, orchSrc, orchDest)
@@ -37,8 +46,145 @@ func TestRun(t *testing.T) {
 		}
 	})
 
+	t.Run("Run again over an existing destination", func(t *testing.T) {
+		err := Run(ctx, defaultConfig(srcDir, destDir))
+		assert.NilError(t, err)
+
+		assertFileIsCopied(t, orchSrc, orchDest)
+		assertFileIsCopied(t, agentSrc, agentDest)
+		assertNoTempFiles(t, destDir)
+	})
+
+	t.Run("Skip files that are unchanged", func(t *testing.T) {
+		before, err := os.Stat(orchDest)
+		assert.NilError(t, err)
+
+		err = Run(ctx, defaultConfig(srcDir, destDir))
+		assert.NilError(t, err)
+
+		after, err := os.Stat(orchDest)
+		assert.NilError(t, err)
+		assert.Check(t, os.SameFile(before, after), "the unchanged file shouldn't have been replaced")
+	})
+
+	t.Run("Copy files that changed despite the same size and modification time", func(t *testing.T) {
+		srcInfo, err := os.Stat(agentSrc)
+		assert.NilError(t, err)
+
+		err = os.WriteFile(agentDest, []byte("mock AGENT data"), srcInfo.Mode())
+		assert.NilError(t, err)
+		err = os.Chtimes(agentDest, srcInfo.ModTime(), srcInfo.ModTime())
+		assert.NilError(t, err)
+
+		err = Run(ctx, defaultConfig(srcDir, destDir))
+		assert.NilError(t, err)
+
+		assertFileIsCopied(t, agentSrc, agentDest)
+	})
+
+	t.Run("Recover from an interrupted copy", func(t *testing.T) {
+		destDir := t.TempDir()
+		orchDest := filepath.Join(destDir, binOrchestrator)
+
+		// Simulate an init container that was killed part way through writing the binaries
+		err := os.WriteFile(orchDest, []byte("mock orch"), 0600)
+		assert.NilError(t, err)
+		err = os.WriteFile(filepath.Join(destDir, "."+binCircleciAgent+".tmp-1234"), []byte("mock ag"), 0600)
+		assert.NilError(t, err)
+
+		err = Run(ctx, defaultConfig(srcDir, destDir))
+		assert.NilError(t, err)
+
+		assertFileIsCopied(t, orchSrc, orchDest)
+		assertFileIsCopied(t, agentSrc, filepath.Join(destDir, binCircleciAgent))
+		assertNoTempFiles(t, destDir)
+	})
+
+	t.Run("Leave the existing binary in place when a copy fails", func(t *testing.T) {
+		srcDir := createMockSourceFiles(t)
+		writeChecksums(t, srcDir, map[string]string{binCircleciAgent: "corrupted agent data"})
+		destDir := t.TempDir()
+		agentDest := filepath.Join(destDir, binCircleciAgent)
+
+		err := os.WriteFile(agentDest, []byte("previous agent data"), 0600)
+		assert.NilError(t, err)
+
+		err = Run(ctx, defaultConfig(srcDir, destDir))
+		assert.Check(t, cmp.ErrorIs(err, ErrChecksumMismatch))
+
+		b, err := os.ReadFile(agentDest) //#nosec:G304 // this is trusted input
+		assert.NilError(t, err)
+		assert.Check(t, cmp.Equal(string(b), "previous agent data"))
+		assertNoTempFiles(t, destDir)
+	})
+
+	t.Run("Verify checksums from the manifest", func(t *testing.T) {
+		srcDir := createMockSourceFiles(t)
+		writeChecksums(t, srcDir, nil)
+
+		err := Run(ctx, defaultConfig(srcDir, t.TempDir()))
+		assert.NilError(t, err)
+	})
+
+	t.Run("Fail on a checksum mismatch", func(t *testing.T) {
+		srcDir := createMockSourceFiles(t)
+		writeChecksums(t, srcDir, map[string]string{binCircleciAgent: "corrupted agent data"})
+
+		err := Run(ctx, defaultConfig(srcDir, t.TempDir()))
+		assert.Check(t, cmp.ErrorIs(err, ErrChecksumMismatch))
+		assert.Check(t, cmp.ErrorContains(err, "checksum mismatch for "+binCircleciAgent))
+	})
+
+	t.Run("Fail when a binary is missing from the manifest", func(t *testing.T) {
+		srcDir := createMockSourceFiles(t)
+		err := os.WriteFile(filepath.Join(srcDir, checksumsFile), nil, 0600)
+		assert.NilError(t, err)
+
+		err = Run(ctx, defaultConfig(srcDir, t.TempDir()))
+		assert.Check(t, cmp.ErrorContains(err, "no checksum for "+binOrchestrator+" in SHA256SUMS"))
+	})
+
+	t.Run("Copy extra files from a manifest", func(t *testing.T) {
+		srcDir := createMockSourceFiles(t)
+		destDir := t.TempDir()
+		helperSrc := filepath.Join(srcDir, "git-credential-helper")
+		err := os.WriteFile(helperSrc, []byte("mock helper data"), 0600)
+		assert.NilError(t, err)
+
+		manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+		err = os.WriteFile(manifestPath, []byte(`{
+	"files": [
+		{"source": "git-credential-helper", "destination": "helper", "mode": "0750", "aliases": ["git-helper"]}
+	]
+}`), 0600)
+		assert.NilError(t, err)
+
+		m, err := LoadManifest(manifestPath)
+		assert.NilError(t, err)
+		m.Files = append(DefaultManifest().Files, m.Files...)
+
+		err = Run(ctx, Config{Source: srcDir, Destination: destDir, Manifest: m})
+		assert.NilError(t, err)
+
+		assertFileIsCopied(t, filepath.Join(srcDir, binOrchestrator), filepath.Join(destDir, binOrchestrator))
+		helperDest := filepath.Join(destDir, "helper")
+		contents, err := os.ReadFile(helperDest) //#nosec:G304 // this is trusted input
+		assert.NilError(t, err)
+		assert.Check(t, cmp.Equal(string(contents), "mock helper data"))
+
+		if runtime.GOOS != "windows" {
+			info, err := os.Stat(helperDest)
+			assert.NilError(t, err)
+			assert.Check(t, cmp.Equal(info.Mode().Perm(), os.FileMode(0750)))
+
+			link, err := os.Readlink(filepath.Join(destDir, "git-helper"))
+			assert.NilError(t, err)
+			assert.Check(t, cmp.Equal(link, helperDest))
+		}
+	})
+
 	t.Run("Fail when source files not present", func(t *testing.T) {
-		err := Run(ctx, srcDir, "non-existent-dir")
+		err := Run(ctx, defaultConfig(srcDir, "non-existent-dir"))
 		if runtime.GOOS == "windows" {
 			assert.Check(t, cmp.ErrorContains(err, "The system cannot find the path specified"))
 		} else {
@@ -47,6 +193,228 @@ func TestRun(t *testing.T) {
 	})
 }
 
+func TestRun_verifySignatures(t *testing.T) {
+	ctx := testcontext.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name string
+
+		sign func(t *testing.T, srcDir string)
+
+		wantError string
+	}{
+		{
+			name: "valid signatures",
+			sign: func(t *testing.T, srcDir string) {
+				writeSignature(t, key, filepath.Join(srcDir, binOrchestrator), ".sig", false)
+				writeSignature(t, key, filepath.Join(srcDir, binCircleciAgent), ".bundle", true)
+			},
+		},
+		{
+			name: "missing signature",
+			sign: func(t *testing.T, srcDir string) {
+				writeSignature(t, key, filepath.Join(srcDir, binCircleciAgent), ".sig", false)
+			},
+			wantError: "invalid signature for " + binOrchestrator + ": no detached signature found",
+		},
+		{
+			name: "signed by another key",
+			sign: func(t *testing.T, srcDir string) {
+				writeSignature(t, otherKey, filepath.Join(srcDir, binOrchestrator), ".sig", false)
+			},
+			wantError: "invalid signature for " + binOrchestrator,
+		},
+		{
+			name: "malformed signature",
+			sign: func(t *testing.T, srcDir string) {
+				err := os.WriteFile(filepath.Join(srcDir, binOrchestrator+".sig"), []byte("not base64!"), 0600)
+				assert.NilError(t, err)
+			},
+			wantError: "invalid signature: malformed signature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := createMockSourceFiles(t)
+			destDir := t.TempDir()
+			tt.sign(t, srcDir)
+
+			c := defaultConfig(srcDir, destDir)
+			c.VerifySignatures = true
+			c.PublicKey = publicKeyPEM(t, key)
+
+			err := Run(ctx, c)
+			if tt.wantError == "" {
+				assert.NilError(t, err)
+				assertFileIsCopied(t, filepath.Join(srcDir, binCircleciAgent), filepath.Join(destDir, binCircleciAgent))
+			} else {
+				assert.Check(t, cmp.ErrorIs(err, ErrInvalidSignature))
+				assert.Check(t, cmp.ErrorContains(err, tt.wantError))
+				_, err = os.Stat(filepath.Join(destDir, binOrchestrator))
+				assert.Check(t, os.IsNotExist(err), "nothing should be copied without a valid signature")
+			}
+		})
+	}
+
+	t.Run("default to the runner-init signing key", func(t *testing.T) {
+		_, err := newVerifier(nil)
+		assert.NilError(t, err)
+	})
+}
+
+func TestRun_selfTest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell script binaries aren't supported on Windows")
+	}
+
+	ctx := testcontext.Background()
+
+	t.Run("Record the versions of executable binaries", func(t *testing.T) {
+		srcDir := t.TempDir()
+		writeScript(t, filepath.Join(srcDir, binOrchestrator), "runner-init version 1.2.3")
+		writeScript(t, filepath.Join(srcDir, binCircleciAgent), "4.5.6")
+
+		c := defaultConfig(srcDir, t.TempDir())
+		c.SelfTest = true
+
+		err := Run(ctx, c)
+		assert.NilError(t, err)
+	})
+
+	t.Run("Fail when a binary isn't executable", func(t *testing.T) {
+		srcDir := t.TempDir()
+		writeScript(t, filepath.Join(srcDir, binOrchestrator), "runner-init version 1.2.3")
+		err := os.WriteFile(filepath.Join(srcDir, binCircleciAgent), []byte("mock agent data"), 0700) //nolint:gosec
+		assert.NilError(t, err)
+
+		c := defaultConfig(srcDir, t.TempDir())
+		c.SelfTest = true
+
+		err = Run(ctx, c)
+		assert.Check(t, cmp.ErrorIs(err, ErrNotExecutable))
+		assert.Check(t, cmp.ErrorContains(err, "binary not executable on this node: "+binCircleciAgent))
+	})
+}
+
+func TestCheckVolume(t *testing.T) {
+	tests := []struct {
+		name string
+
+		volume   volumeInfo
+		required uint64
+
+		wantError string
+	}{
+		{
+			name:     "usable",
+			volume:   volumeInfo{available: 100 << 20},
+			required: 80 << 20,
+		},
+		{
+			name:      "not enough space",
+			volume:    volumeInfo{available: 10 << 20},
+			required:  80 << 20,
+			wantError: "destination volume is unusable: /opt/circleci/bin: it has 10.0 MiB of free space, but 80.0 MiB is needed",
+		},
+		{
+			name:      "read-only",
+			volume:    volumeInfo{available: 100 << 20, readOnly: true},
+			required:  80 << 20,
+			wantError: "destination volume is unusable: /opt/circleci/bin: it is mounted read-only",
+		},
+		{
+			name:     "noexec and full",
+			volume:   volumeInfo{available: 512, noExec: true},
+			required: 1536,
+			wantError: "destination volume is unusable: /opt/circleci/bin: " +
+				"it is mounted noexec, so the binaries couldn't be executed from it and " +
+				"it has 512 B of free space, but 1.5 KiB is needed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVolume("/opt/circleci/bin", tt.volume, tt.required)
+			if tt.wantError == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.Check(t, cmp.ErrorIs(err, ErrUnusableVolume))
+				assert.Check(t, cmp.Error(err, tt.wantError))
+			}
+		})
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	tests := []struct {
+		name string
+
+		manifest string
+
+		wantManifest Manifest
+		wantError    string
+	}{
+		{
+			name:     "valid",
+			manifest: `{"files": [{"source": "tool", "destination": "bin-tool", "mode": "0755", "aliases": ["t"]}]}`,
+			wantManifest: Manifest{
+				Files: []File{
+					{Source: "tool", Destination: "bin-tool", Mode: 0755, Aliases: []string{"t"}},
+				},
+			},
+		},
+		{
+			name:      "no files",
+			manifest:  `{"files": []}`,
+			wantError: "invalid manifest: no files listed",
+		},
+		{
+			name:      "path outside the source directory",
+			manifest:  `{"files": [{"source": "../tool"}]}`,
+			wantError: `invalid manifest: "../tool" must be a plain file name`,
+		},
+		{
+			name:      "duplicate destination",
+			manifest:  `{"files": [{"source": "tool"}, {"source": "other", "aliases": ["tool"]}]}`,
+			wantError: `invalid manifest: duplicate destination "tool"`,
+		},
+		{
+			name:      "invalid mode",
+			manifest:  `{"files": [{"source": "tool", "mode": "rwx"}]}`,
+			wantError: `failed to unmarshal manifest`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "manifest.json")
+			err := os.WriteFile(path, []byte(tt.manifest), 0600)
+			assert.NilError(t, err)
+
+			m, err := LoadManifest(path)
+			if tt.wantError == "" {
+				assert.NilError(t, err)
+				assert.Check(t, cmp.DeepEqual(m, tt.wantManifest))
+			} else {
+				assert.Check(t, cmp.ErrorContains(err, tt.wantError))
+			}
+		})
+	}
+}
+
+func defaultConfig(srcDir, destDir string) Config {
+	return Config{
+		Source:      srcDir,
+		Destination: destDir,
+		Manifest:    DefaultManifest(),
+	}
+}
+
 // Mock source file creation for testing purposes
 func createMockSourceFiles(t *testing.T) string {
 	t.Helper()
@@ -62,6 +430,72 @@ func createMockSourceFiles(t *testing.T) string {
 	return srcDir
 }
 
+// writeChecksums writes a digest manifest for the mock source files.
+// The contents of any binaries in the overrides are hashed in place of the real contents.
+func writeChecksums(t *testing.T, srcDir string, overrides map[string]string) {
+	t.Helper()
+
+	var manifest string
+	for _, name := range []string{binOrchestrator, binCircleciAgent} {
+		b, err := os.ReadFile(filepath.Join(srcDir, name)) //#nosec:G304 // this is trusted input
+		assert.NilError(t, err)
+
+		if override, ok := overrides[name]; ok {
+			b = []byte(override)
+		}
+
+		sum := sha256.Sum256(b)
+		manifest += fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+
+	err := os.WriteFile(filepath.Join(srcDir, checksumsFile), []byte(manifest), 0600)
+	assert.NilError(t, err)
+}
+
+func writeScript(t *testing.T, path, version string) {
+	t.Helper()
+
+	err := os.WriteFile(path, []byte("#!/bin/sh\necho '"+version+"'\n"), 0700) //nolint:gosec // this is a test
+	assert.NilError(t, err)
+}
+
+// writeSignature signs the file in the same way as `cosign sign-blob`
+func writeSignature(t *testing.T, key *ecdsa.PrivateKey, path, suffix string, bundle bool) {
+	t.Helper()
+
+	b, err := os.ReadFile(path) //#nosec:G304 // this is trusted input
+	assert.NilError(t, err)
+
+	digest := sha256.Sum256(b)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	assert.NilError(t, err)
+
+	contents := base64.StdEncoding.EncodeToString(sig)
+	if bundle {
+		contents = fmt.Sprintf(`{"base64Signature": %q}`, contents)
+	}
+
+	err = os.WriteFile(path+suffix, []byte(contents), 0600)
+	assert.NilError(t, err)
+}
+
+func publicKeyPEM(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NilError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+
+	tmpFiles, err := filepath.Glob(filepath.Join(dir, tmpPattern))
+	assert.NilError(t, err)
+	assert.Check(t, cmp.Len(tmpFiles, 0), "no temporary files should be left behind")
+}
+
 func assertFileIsCopied(t *testing.T, src, dest string) {
 	t.Helper()
 
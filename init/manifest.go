@@ -0,0 +1,111 @@
+package init
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/goccy/go-json"
+)
+
+// Manifest describes the files that init distributes to the task container
+type Manifest struct {
+	Files []File `json:"files"`
+}
+
+type File struct {
+	// Source is the name of the file in the source directory
+	Source string `json:"source"`
+	// Destination is the name of the file in the destination directory, which defaults to the source name
+	Destination string `json:"destination,omitempty"`
+	// Mode overrides the permissions of the file, which otherwise are preserved from the source
+	Mode Mode `json:"mode,omitempty"`
+	// Aliases are additional names in the destination directory for the file
+	Aliases []string `json:"aliases,omitempty"`
+	// VersionArgs are the arguments to print the version of a binary, which are used for the optional self-test
+	VersionArgs []string `json:"version_args,omitempty"`
+}
+
+// Mode is a file mode given as an octal string in the manifest (e.g., "0755")
+type Mode os.FileMode
+
+func (m *Mode) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("mode must be an octal string: %w", err)
+	}
+
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+		return fmt.Errorf("invalid mode %q", s)
+	}
+
+	*m = Mode(mode)
+	return nil
+}
+
+// DefaultManifest is the manifest for the orchestrator and task agent binaries shipped in the init image
+func DefaultManifest() Manifest {
+	return Manifest{
+		Files: []File{
+			{Source: binOrchestrator, VersionArgs: []string{"--version"}},
+			{Source: binCircleciAgent, Aliases: []string{binCircleci}, VersionArgs: []string{"--version"}},
+		},
+	}
+}
+
+func LoadManifest(path string) (Manifest, error) {
+	b, err := os.ReadFile(path) //#nosec:G304 // this is trusted input
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return Manifest{}, fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+
+	if err := m.validate(); err != nil {
+		return Manifest{}, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	return m, nil
+}
+
+func (m Manifest) validate() error {
+	if len(m.Files) == 0 {
+		return errors.New("no files listed")
+	}
+
+	seen := map[string]bool{}
+	for _, f := range m.Files {
+		for _, name := range append([]string{f.Source, f.destination()}, f.Aliases...) {
+			if !isPlainName(name) {
+				return fmt.Errorf("%q must be a plain file name", name)
+			}
+		}
+
+		for _, name := range append([]string{f.destination()}, f.Aliases...) {
+			if seen[name] {
+				return fmt.Errorf("duplicate destination %q", name)
+			}
+			seen[name] = true
+		}
+	}
+
+	return nil
+}
+
+func (f File) destination() string {
+	if f.Destination != "" {
+		return f.Destination
+	}
+	return f.Source
+}
+
+// isPlainName checks the name can't escape the source or destination directory
+func isPlainName(name string) bool {
+	return name != "" && name != "." && name != ".." && filepath.Base(name) == name
+}
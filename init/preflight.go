@@ -0,0 +1,95 @@
+package init
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/circleci/ex/o11y"
+
+	"github.com/circleci/runner-init/internal/bytesize"
+)
+
+var ErrUnusableVolume = errors.New("destination volume is unusable")
+
+type volumeInfo struct {
+	available uint64
+	readOnly  bool
+	noExec    bool
+}
+
+// preflight checks the destination volume can hold and execute the files in the manifest before anything is copied.
+// Otherwise, a copy can fail part way through with a raw syscall error, or succeed only for the task container to
+// later fail to execute the binaries.
+func preflight(ctx context.Context, c Config) (err error) {
+	_, span := o11y.StartSpan(ctx, "orchestrator: init: preflight")
+	defer o11y.End(span, &err)
+
+	required, err := requiredSpace(c)
+	if err != nil {
+		return err
+	}
+	span.AddField("required_bytes", required)
+
+	v, err := statVolume(c.Destination)
+	if err != nil {
+		return fmt.Errorf("failed to check the destination volume %s: %w", c.Destination, err)
+	}
+	span.AddField("available_bytes", v.available)
+	span.AddField("read_only", v.readOnly)
+	span.AddField("noexec", v.noExec)
+
+	return checkVolume(c.Destination, v, required)
+}
+
+func checkVolume(dir string, v volumeInfo, required uint64) error {
+	var problems []string
+	if v.readOnly {
+		problems = append(problems, "it is mounted read-only")
+	}
+	if v.noExec {
+		problems = append(problems, "it is mounted noexec, so the binaries couldn't be executed from it")
+	}
+	if v.available < required {
+		problems = append(problems, fmt.Sprintf("it has %s of free space, but %s is needed",
+			bytesize.Format(v.available), bytesize.Format(required)))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s: %s", ErrUnusableVolume, dir, strings.Join(problems, " and "))
+	}
+	return nil
+}
+
+// requiredSpace sums the size of the files that need to be copied.
+// Files that are likely unchanged at the destination are excluded, since they will usually be skipped.
+func requiredSpace(c Config) (required uint64, err error) {
+	for _, f := range c.Manifest.Files {
+		srcInfo, err := os.Stat(filepath.Join(c.Source, f.Source))
+		if err != nil {
+			return 0, err
+		}
+
+		dests := []string{f.destination()}
+		if runtime.GOOS == "windows" {
+			// Aliases are copies rather than symlinks on Windows
+			dests = append(dests, f.Aliases...)
+		}
+
+		for _, dest := range dests {
+			destInfo, err := os.Lstat(filepath.Join(c.Destination, dest))
+			if err == nil && destInfo.Mode().IsRegular() &&
+				destInfo.Size() == srcInfo.Size() && destInfo.ModTime().Equal(srcInfo.ModTime()) {
+				continue
+			}
+			//nolint:gosec // G115: file sizes are never negative
+			required += uint64(srcInfo.Size())
+		}
+	}
+
+	return required, nil
+}
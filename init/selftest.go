@@ -0,0 +1,62 @@
+package init
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/circleci/ex/o11y"
+)
+
+var ErrNotExecutable = errors.New("binary not executable on this node")
+
+const selfTestTimeout = 30 * time.Second
+
+// selfTest executes the installed binaries with their version arguments. This catches problems such as an image for
+// the wrong architecture or a missing loader before the task Pod reaches the primary container.
+func selfTest(ctx context.Context, c Config) (err error) {
+	ctx, span := o11y.StartSpan(ctx, "orchestrator: init: self-test")
+	defer o11y.End(span, &err)
+
+	for _, f := range c.Manifest.Files {
+		if len(f.VersionArgs) == 0 {
+			continue
+		}
+
+		name := f.destination()
+		version, err := execVersion(ctx, filepath.Join(c.Destination, name), f.VersionArgs)
+		if err != nil {
+			return err
+		}
+
+		span.AddField("version."+name, version)
+		o11y.Log(ctx, "installed binary is executable", o11y.Field("binary", name), o11y.Field("version", version))
+	}
+
+	return nil
+}
+
+func execVersion(ctx context.Context, path string, args []string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...) //#nosec:G204 // this is intentionally setting up a command
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		if output := strings.TrimSpace(out.String()); output != "" {
+			err = fmt.Errorf("%w: %s", err, output)
+		}
+		return "", fmt.Errorf("%w: %s: %w", ErrNotExecutable, filepath.Base(path), err)
+	}
+
+	version, _, _ := strings.Cut(strings.TrimSpace(out.String()), "\n")
+	return version, nil
+}
@@ -0,0 +1,120 @@
+package init
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/circleci/ex/o11y"
+	"github.com/goccy/go-json"
+
+	runnerinit "github.com/circleci/runner-init"
+)
+
+// signatureSuffixes are appended to the source file name to find its detached signature, in order of preference.
+// A bundle is the output of `cosign sign-blob --bundle`, while a signature is the output of `--output-signature`.
+var signatureSuffixes = []string{".bundle", ".sig"}
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+type verifier struct {
+	key *ecdsa.PublicKey
+}
+
+// newVerifier parses a PEM-encoded ECDSA public key, as generated by `cosign generate-key-pair`.
+// The runner-init signing key is used if no key is given.
+func newVerifier(pemKey []byte) (*verifier, error) {
+	if len(pemKey) == 0 {
+		pemKey = runnerinit.CosignPublicKey
+	}
+
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+
+	return &verifier{key: ecdsaKey}, nil
+}
+
+// verify checks the detached signature of the file at the given path,
+// returning the digest of the file that was verified.
+func (v *verifier) verify(ctx context.Context, path string) (digest string, err error) {
+	_, span := o11y.StartSpan(ctx, "orchestrator: init: verify-signature")
+	defer o11y.End(span, &err)
+
+	sig, sigPath, err := readSignature(path)
+	if err != nil {
+		return "", err
+	}
+	span.AddField("signature", sigPath)
+
+	digest, err = fileChecksum(path)
+	if err != nil {
+		return "", err
+	}
+	span.AddField("sha256", digest)
+
+	b, err := hex.DecodeString(digest)
+	if err != nil {
+		return "", err
+	}
+
+	if !ecdsa.VerifyASN1(v.key, b, sig) {
+		return "", fmt.Errorf("%w for %s", ErrInvalidSignature, filepath.Base(path))
+	}
+
+	return digest, nil
+}
+
+func readSignature(path string) (sig []byte, sigPath string, err error) {
+	var raw []byte
+	for _, suffix := range signatureSuffixes {
+		sigPath = path + suffix
+		raw, err = os.ReadFile(sigPath) //#nosec:G304 // this is trusted input
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, "", err
+		}
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w for %s: no detached signature found", ErrInvalidSignature, filepath.Base(path))
+	}
+
+	b64 := string(bytes.TrimSpace(raw))
+	if bytes.HasPrefix(raw, []byte("{")) {
+		var bundle struct {
+			Base64Signature string `json:"base64Signature"`
+		}
+		if err := json.Unmarshal(raw, &bundle); err != nil {
+			return nil, "", fmt.Errorf("%w: malformed bundle %s: %v", ErrInvalidSignature, sigPath, err)
+		}
+		b64 = bundle.Base64Signature
+	}
+
+	sig, err = base64.StdEncoding.DecodeString(b64)
+	if err != nil || len(sig) == 0 {
+		return nil, "", fmt.Errorf("%w: malformed signature %s", ErrInvalidSignature, sigPath)
+	}
+
+	return sig, sigPath, nil
+}
@@ -0,0 +1,18 @@
+package bytesize
+
+import "fmt"
+
+// Format formats a number of bytes using binary units, such as "1.5 KiB"
+func Format(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,26 @@
+package bytesize
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		bytes uint64
+		want  string
+	}{
+		{bytes: 0, want: "0 B"},
+		{bytes: 1023, want: "1023 B"},
+		{bytes: 1536, want: "1.5 KiB"},
+		{bytes: 80 << 20, want: "80.0 MiB"},
+		{bytes: 2 << 30, want: "2.0 GiB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, Format(tt.bytes), tt.want)
+		})
+	}
+}
@@ -19,9 +19,11 @@ import (
 type RunnerAPI struct {
 	*httprecorder.RequestRecorder
 	http.Handler
-	tasks    []Task
-	events   []TaskEvent
-	unclaims []TaskUnclaim
+	tasks      []Task
+	events     []TaskEvent
+	unclaims   []TaskUnclaim
+	heartbeats []Heartbeat
+	lifecycle  []LifecycleEvent
 
 	mu sync.RWMutex
 }
@@ -37,6 +39,8 @@ type TaskEvent struct {
 	Allocation     string `json:"allocation"`
 	TimestampMilli int64  `json:"timestamp"`
 	Message        []byte `json:"message"`
+	Code           string `json:"code,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 var CmpTaskEvent = gocmp.Options{
@@ -46,9 +50,24 @@ var CmpTaskEvent = gocmp.Options{
 	}),
 }
 
+type Heartbeat struct {
+	Allocation     string `json:"allocation"`
+	TimestampMilli int64  `json:"timestamp"`
+	Phase          string `json:"phase"`
+	Correlation    string `json:"correlation"`
+}
+
+type LifecycleEvent struct {
+	Allocation     string `json:"allocation"`
+	TimestampMilli int64  `json:"timestamp"`
+	Event          string `json:"event"`
+	Correlation    string `json:"correlation"`
+}
+
 type TaskUnclaim struct {
-	ID    string `json:"task_id" binding:"required"`
-	Token string `json:"task_token" binding:"required"`
+	ID             string `json:"task_id" binding:"required"`
+	Token          string `json:"task_token" binding:"required"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 func New(ctx context.Context, tasks []Task) *RunnerAPI {
@@ -65,6 +84,8 @@ func New(ctx context.Context, tasks []Task) *RunnerAPI {
 
 	r.Use(ra.authHandler)
 	r.POST("/api/v2/task/event/fail", ra.failTaskHandler)
+	r.POST("/api/v2/task/event/heartbeat", ra.heartbeatHandler)
+	r.POST("/api/v2/task/event/lifecycle", ra.lifecycleHandler)
 	r.POST("/api/v3/runner/unclaim", ra.unclaimHandler)
 
 	return ra
@@ -84,6 +105,20 @@ func (r *RunnerAPI) TaskUnclaims() []TaskUnclaim {
 	return r.unclaims
 }
 
+func (r *RunnerAPI) Heartbeats() []Heartbeat {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.heartbeats
+}
+
+func (r *RunnerAPI) LifecycleEvents() []LifecycleEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lifecycle
+}
+
 func (r *RunnerAPI) failTaskHandler(c *gin.Context) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -104,6 +139,46 @@ func (r *RunnerAPI) failTaskHandler(c *gin.Context) {
 	}
 }
 
+func (r *RunnerAPI) heartbeatHandler(c *gin.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task := r.findTask(c.Request)
+
+	var hb Heartbeat
+	err := c.BindJSON(&hb)
+	r.heartbeats = append(r.heartbeats, hb)
+
+	switch {
+	case err != nil:
+		c.AbortWithStatus(http.StatusBadRequest)
+	case hb.Allocation != task.Allocation:
+		c.AbortWithStatus(http.StatusNotFound)
+	default:
+		c.AbortWithStatus(http.StatusOK)
+	}
+}
+
+func (r *RunnerAPI) lifecycleHandler(c *gin.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task := r.findTask(c.Request)
+
+	var event LifecycleEvent
+	err := c.BindJSON(&event)
+	r.lifecycle = append(r.lifecycle, event)
+
+	switch {
+	case err != nil:
+		c.AbortWithStatus(http.StatusBadRequest)
+	case event.Allocation != task.Allocation:
+		c.AbortWithStatus(http.StatusNotFound)
+	default:
+		c.AbortWithStatus(http.StatusOK)
+	}
+}
+
 func (r *RunnerAPI) unclaimHandler(c *gin.Context) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -0,0 +1,139 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/circleci/ex/o11y"
+
+	"github.com/circleci/runner-init/task/cmd"
+)
+
+// BackgroundProcess is a process that runs alongside the task agent for the duration of the task,
+// such as a local proxy or a metrics exporter
+type BackgroundProcess struct {
+	Name       string   `json:"name"`
+	Cmd        []string `json:"cmd"`
+	Env        []string `json:"env"`
+	User       string   `json:"user"`
+	WorkingDir string   `json:"working_dir"`
+	// ReadinessCmd is run repeatedly after the process starts until it succeeds,
+	// so the next process or the task agent isn't started until the process is ready
+	ReadinessCmd []string `json:"readiness_cmd"`
+}
+
+type backgroundProcess struct {
+	name   string
+	cmd    cmd.Command
+	cancel context.CancelFunc
+}
+
+var (
+	// These can be overridden in tests
+	backgroundReadinessInterval = 1 * time.Second
+	backgroundReadinessTimeout  = 5 * time.Minute
+)
+
+func validateBackgroundProcesses(processes []BackgroundProcess) error {
+	seen := map[string]bool{}
+	for _, p := range processes {
+		if p.Name == "" {
+			return errors.New("background process is missing a name")
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate background process %q", p.Name)
+		}
+		seen[p.Name] = true
+
+		if len(p.Cmd) == 0 {
+			return fmt.Errorf("background process %q is missing a command", p.Name)
+		}
+	}
+	return nil
+}
+
+// startBackgroundProcesses starts the background processes in order, waiting for each to become ready
+func (o *Orchestrator) startBackgroundProcesses(ctx context.Context) (err error) {
+	ctx, span := o11y.StartSpan(ctx, "orchestrator: start-background-processes")
+	defer o11y.End(span, &err)
+
+	span.AddField("count", len(o.config.BackgroundProcesses))
+
+	for _, p := range o.config.BackgroundProcesses {
+		if err := o.startBackgroundProcess(ctx, p); err != nil {
+			// The task agent won't be started, so stop the processes that were
+			o.stopBackgroundProcesses(ctx)
+			return fmt.Errorf("error starting background process %q: %w", p.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (o *Orchestrator) startBackgroundProcess(ctx context.Context, p BackgroundProcess) (err error) {
+	ctx, span := o11y.StartSpan(ctx, "orchestrator: start-background-process")
+	defer o11y.End(span, &err)
+
+	span.AddField("name", p.Name)
+
+	// Each process gets its own context, so they can be stopped one at a time
+	procCtx, cancel := context.WithCancel(ctx)
+	bp := &backgroundProcess{
+		name:   p.Name,
+		cmd:    cmd.New(procCtx, p.Cmd, false, p.User, p.Env...),
+		cancel: cancel,
+	}
+	bp.cmd.SetDir(p.WorkingDir)
+
+	if err := bp.cmd.Start(); err != nil {
+		cancel()
+		return err
+	}
+	o.background = append(o.background, bp)
+
+	if len(p.ReadinessCmd) == 0 {
+		return nil
+	}
+
+	ctx, cancelReadiness := context.WithTimeout(ctx, backgroundReadinessTimeout)
+	defer cancelReadiness()
+
+	for attempt := 1; ; attempt++ {
+		span.AddField("readiness_attempts", attempt)
+
+		check := cmd.New(ctx, p.ReadinessCmd, false, p.User, p.Env...)
+		check.SetDir(p.WorkingDir)
+		checkErr := check.Start()
+		if checkErr == nil {
+			checkErr = check.Wait()
+		}
+		if checkErr == nil {
+			return nil
+		}
+
+		if running, _ := bp.cmd.IsRunning(); !running {
+			return fmt.Errorf("exited before becoming ready: %w", bp.cmd.Wait())
+		}
+
+		select {
+		case <-time.After(backgroundReadinessInterval):
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting to become ready: %w", errors.Join(ctx.Err(), checkErr))
+		}
+	}
+}
+
+// stopBackgroundProcesses stops the background processes in the reverse order they were started.
+// This must be done before the reaper is started, so their exit statuses aren't stolen from Go exec.
+func (o *Orchestrator) stopBackgroundProcesses(ctx context.Context) {
+	for i := len(o.background) - 1; i >= 0; i-- {
+		p := o.background[i]
+
+		p.cancel()
+		err := p.cmd.Wait()
+		o11y.Log(ctx, "stopped background process", o11y.Field("name", p.name), o11y.Field("exit", err))
+	}
+	o.background = nil
+}
@@ -6,8 +6,10 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"sync"
 	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 type Command struct {
@@ -17,6 +19,42 @@ type Command struct {
 	isCompleted    atomic.Bool
 	forwardSignals bool
 	waitCh         chan error
+	waitOnce       sync.Once
+	waitErr        error
+	doneCh         chan struct{}
+	startedAt      time.Time
+	exitStatus     ExitStatus
+	termination    Termination
+	ctx            context.Context
+}
+
+// Termination configures a staged shutdown of the process group when the command's context is cancelled.
+// Termination signals are unsupported on Windows, where the process group is always killed immediately.
+type Termination struct {
+	// Signal is first sent to the process group, so it has a chance to shut down gracefully.
+	// The process group is killed immediately if unset.
+	Signal syscall.Signal
+	// GracePeriod is how long to wait after the signal before killing the process group
+	GracePeriod time.Duration
+}
+
+// ExitStatus describes how a completed process exited
+type ExitStatus struct {
+	// ExitCode is -1 if the process was terminated by a signal
+	ExitCode int
+	// Signal is the signal that terminated the process, if any
+	Signal syscall.Signal
+	// CoreDumped is whether the terminated process dumped core
+	CoreDumped bool
+	// Duration is how long the process ran for
+	Duration time.Duration
+	// Stderr is an excerpt of the start and end of the process's standard error
+	Stderr string
+}
+
+// Signaled reports whether the process was terminated by a signal
+func (s ExitStatus) Signaled() bool {
+	return s.Signal != 0
 }
 
 func New(ctx context.Context, cmd []string, forwardSignals bool, user string, env ...string) Command {
@@ -26,15 +64,28 @@ func New(ctx context.Context, cmd []string, forwardSignals bool, user string, en
 		stderrSaver:    s,
 		forwardSignals: forwardSignals,
 		waitCh:         make(chan error, 1),
+		doneCh:         make(chan struct{}),
+		ctx:            ctx,
 	}
 }
 
+// SetDir sets the working directory of the process, which defaults to that of the orchestrator
+func (c *Command) SetDir(dir string) {
+	c.cmd.Dir = dir
+}
+
+// SetTermination sets how the process group is stopped on cancellation, which must be done before it is started
+func (c *Command) SetTermination(t Termination) {
+	c.termination = t
+}
+
 func (c *Command) Start() error {
 	cmd := c.cmd
 
 	if err := c.start(); err != nil {
 		return err
 	}
+	c.startedAt = time.Now()
 
 	if cmd.Process == nil {
 		return fmt.Errorf("no underlying process")
@@ -71,16 +122,25 @@ func (c *Command) StartWithStdin(b []byte) error {
 	return c.Start()
 }
 
+// Wait waits for the process to exit, which is safe to call more than once
 func (c *Command) Wait() error {
-	return <-c.waitCh
+	c.waitOnce.Do(func() {
+		c.waitErr = <-c.waitCh
+	})
+	return c.waitErr
 }
 
 func (c *Command) wait() error {
 	cmd := c.cmd
 	defer func() {
-		_ = cmd.Cancel()
-
+		if cmd.ProcessState != nil {
+			c.exitStatus = c.newExitStatus(cmd.ProcessState)
+		}
 		c.isCompleted.Store(cmd.ProcessState != nil)
+		close(c.doneCh)
+
+		// Kill anything left behind in the process group
+		_ = cmd.Cancel()
 	}()
 
 	err := cmd.Wait()
@@ -93,6 +153,15 @@ func (c *Command) wait() error {
 	return err
 }
 
+// Pid is the process ID once the process has started, or zero before then
+func (c *Command) Pid() int {
+	if !c.isStarted.Load() {
+		return 0
+	}
+
+	return c.cmd.Process.Pid
+}
+
 func (c *Command) IsRunning() (bool, error) {
 	if !c.isStarted.Load() {
 		return false, nil
@@ -101,6 +170,30 @@ func (c *Command) IsRunning() (bool, error) {
 	return !c.isCompleted.Load(), nil
 }
 
+// ExitStatus returns how the process exited once it has completed
+func (c *Command) ExitStatus() (ExitStatus, bool) {
+	if !c.isCompleted.Load() {
+		return ExitStatus{}, false
+	}
+
+	return c.exitStatus, true
+}
+
+func (c *Command) newExitStatus(state *os.ProcessState) ExitStatus {
+	s := ExitStatus{
+		ExitCode: state.ExitCode(),
+		Duration: time.Since(c.startedAt),
+		Stderr:   string(c.stderrSaver.Bytes()),
+	}
+
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		s.Signal = ws.Signal()
+		s.CoreDumped = ws.CoreDump()
+	}
+
+	return s
+}
+
 func newCmd(ctx context.Context, argv []string, user string, stderrSaver *prefixSuffixSaver, env ...string) *exec.Cmd {
 	//#nosec:G204 // this is intentionally setting up a command
 	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
@@ -4,14 +4,18 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
 	"os/user"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/circleci/ex/o11y"
+	"golang.org/x/sys/unix"
 )
 
 func forwardSignals(cmd *exec.Cmd) {
@@ -43,13 +47,63 @@ func switchUser(ctx context.Context, cmd *exec.Cmd, username string) {
 func additionalSetup(_ context.Context, cmd *exec.Cmd) {
 	cmd.SysProcAttr.Setpgid = true
 	cmd.SysProcAttr.Pdeathsig = syscall.SIGKILL
-
-	cmd.Cancel = func() error {
-		// Kill the child process group
-		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
-	}
 }
 
 func (c *Command) start() error {
+	c.cmd.Cancel = c.cancel
 	return c.cmd.Start()
 }
+
+// cancel stops the child process group, escalating from the termination signal to SIGKILL
+// if the process doesn't exit within the grace period
+func (c *Command) cancel() error {
+	pgid := -c.cmd.Process.Pid
+	t := c.termination
+
+	if t.Signal == 0 || c.isCompleted.Load() {
+		return syscall.Kill(pgid, syscall.SIGKILL)
+	}
+
+	_, span := o11y.StartSpan(c.ctx, "cmd: terminate")
+	span.AddField("signal", t.Signal.String())
+	span.AddField("grace_period", t.GracePeriod.String())
+
+	if err := syscall.Kill(pgid, t.Signal); err != nil {
+		o11y.End(span, &err)
+		return syscall.Kill(pgid, syscall.SIGKILL)
+	}
+	span.AddField("signalled", true)
+
+	go func() {
+		var err error
+		defer o11y.End(span, &err)
+
+		select {
+		case <-c.doneCh:
+			span.AddField("exited_within_grace_period", true)
+		case <-time.After(t.GracePeriod):
+			span.AddField("exited_within_grace_period", false)
+			err = syscall.Kill(pgid, syscall.SIGKILL)
+			span.AddField("killed", err == nil)
+		}
+	}()
+
+	return nil
+}
+
+// ParseSignal parses a signal name, such as "SIGTERM"
+func ParseSignal(name string) (syscall.Signal, error) {
+	sig := unix.SignalNum(strings.ToUpper(name))
+	if sig == 0 {
+		return 0, fmt.Errorf("unknown signal %q", name)
+	}
+	return sig, nil
+}
+
+// SignalName is the name of a signal, such as "SIGTERM"
+func SignalName(sig syscall.Signal) string {
+	if name := unix.SignalName(sig); name != "" {
+		return name
+	}
+	return sig.String()
+}
@@ -3,6 +3,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"syscall"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/circleci/ex/testing/testcontext"
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
 )
 
 func TestCommand_notifySignals(t *testing.T) {
@@ -34,3 +36,104 @@ func TestCommand_notifySignals(t *testing.T) {
 	_, err = os.Stat(scratchDir + "/sighup")
 	assert.NilError(t, err)
 }
+
+func TestCommand_ExitStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		wantCode   int
+		wantSignal syscall.Signal
+		wantStderr string
+	}{
+		{
+			name:       "exited",
+			script:     "echo 'oh no' >&2; exit 3",
+			wantCode:   3,
+			wantStderr: "oh no\n",
+		},
+		{
+			name:       "killed",
+			script:     "kill -KILL $$",
+			wantCode:   -1,
+			wantSignal: syscall.SIGKILL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testcontext.Background()
+			cmd := New(ctx, []string{"/bin/sh", "-c", tt.script}, false, "")
+
+			_, ok := cmd.ExitStatus()
+			assert.Check(t, !ok, "expected no exit status before the command has completed")
+
+			assert.NilError(t, cmd.Start())
+			assert.Check(t, cmd.Wait() != nil)
+
+			status, ok := cmd.ExitStatus()
+			assert.Assert(t, ok)
+			assert.Check(t, cmp.Equal(status.ExitCode, tt.wantCode))
+			assert.Check(t, cmp.Equal(status.Signal, tt.wantSignal))
+			assert.Check(t, cmp.Equal(status.Signaled(), tt.wantSignal != 0))
+			assert.Check(t, cmp.Equal(status.Stderr, tt.wantStderr))
+			assert.Check(t, status.Duration > 0)
+		})
+	}
+}
+
+func TestCommand_termination(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		wantSignal syscall.Signal
+		wantFile   bool
+	}{
+		{
+			name:     "exits within grace period",
+			script:   "trap 'touch %s/terminated; exit 0' TERM; sleep 10 & wait",
+			wantFile: true,
+		},
+		{
+			name:       "killed after grace period",
+			script:     "trap '' TERM; sleep 10 # %s",
+			wantSignal: syscall.SIGKILL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scratchDir := t.TempDir()
+			ctx, cancel := context.WithCancel(testcontext.Background())
+			defer cancel()
+
+			cmd := New(ctx, []string{"/bin/sh", "-c", fmt.Sprintf(tt.script, scratchDir)}, false, "")
+			cmd.SetTermination(Termination{Signal: syscall.SIGTERM, GracePeriod: 500 * time.Millisecond})
+			assert.NilError(t, cmd.Start())
+
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+			_ = cmd.Wait()
+
+			status, ok := cmd.ExitStatus()
+			assert.Assert(t, ok)
+			assert.Check(t, cmp.Equal(status.Signal, tt.wantSignal))
+
+			_, err := os.Stat(scratchDir + "/terminated")
+			assert.Check(t, cmp.Equal(err == nil, tt.wantFile))
+		})
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	sig, err := ParseSignal("sigterm")
+	assert.NilError(t, err)
+	assert.Check(t, cmp.Equal(sig, syscall.SIGTERM))
+
+	_, err = ParseSignal("SIGNOPE")
+	assert.Check(t, cmp.ErrorContains(err, `unknown signal "SIGNOPE"`))
+}
+
+func TestSignalName(t *testing.T) {
+	assert.Check(t, cmp.Equal(SignalName(syscall.SIGTERM), "SIGTERM"))
+	assert.Check(t, cmp.Equal(SignalName(syscall.Signal(0)), "signal 0"))
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"syscall"
 	"unsafe"
 
 	"github.com/circleci/ex/o11y"
@@ -56,6 +57,16 @@ func (c *Command) start() error {
 	return nil
 }
 
+// ParseSignal always fails, since termination signals are unsupported on Windows
+func ParseSignal(name string) (syscall.Signal, error) {
+	return 0, fmt.Errorf("signal %q is unsupported on windows", name)
+}
+
+// SignalName is the description of a signal, since signal names are unsupported on Windows
+func SignalName(sig syscall.Signal) string {
+	return sig.String()
+}
+
 type processExitGroup windows.Handle
 
 func newProcessExitGroup() (processExitGroup, error) {
@@ -0,0 +1,192 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/circleci/ex/o11y"
+
+	"github.com/circleci/runner-init/task/cmd"
+)
+
+const defaultReadinessInterval = 1 * time.Second
+
+var (
+	// readinessCheckTimeout bounds each check, so one that hangs doesn't stop the condition being polled.
+	// This can be overridden in tests.
+	readinessCheckTimeout = 5 * time.Second
+
+	// readinessHTTPClient is separate from the default client, so its settings aren't shared with anything else
+	readinessHTTPClient = &http.Client{}
+)
+
+// ReadinessCondition must be met before the task agent is started. Exactly one of the checks must be set.
+// Each check times out after 5 seconds, so one that hangs is retried.
+type ReadinessCondition struct {
+	// Name identifies the condition in errors, which defaults to a description of the check
+	Name string `json:"name"`
+
+	// File is a path that must exist
+	File string `json:"file"`
+	// TCP is an address (host:port) that must accept connections
+	TCP string `json:"tcp"`
+	// HTTP is a URL that must return a 2xx status to a GET request
+	HTTP string `json:"http"`
+	// Exec is a command that must exit successfully
+	Exec []string `json:"exec"`
+
+	// Timeout is how long to wait for the condition, which defaults to 10 minutes
+	Timeout time.Duration `json:"timeout"`
+	// Interval is how often the condition is checked, which defaults to 1 second
+	Interval time.Duration `json:"interval"`
+}
+
+func (rc ReadinessCondition) validate() error {
+	checks := 0
+	for _, set := range []bool{rc.File != "", rc.TCP != "", rc.HTTP != "", len(rc.Exec) > 0} {
+		if set {
+			checks++
+		}
+	}
+	if checks != 1 {
+		return fmt.Errorf("readiness condition %q must have exactly one of file, tcp, http or exec", rc.name())
+	}
+	return nil
+}
+
+func (rc ReadinessCondition) name() string {
+	switch {
+	case rc.Name != "":
+		return rc.Name
+	case rc.File != "":
+		return "file " + rc.File
+	case rc.TCP != "":
+		return "tcp " + rc.TCP
+	case rc.HTTP != "":
+		return "http " + rc.HTTP
+	case len(rc.Exec) > 0:
+		return fmt.Sprintf("exec %s", rc.Exec)
+	default:
+		return "unnamed"
+	}
+}
+
+// wait polls the condition until it is met or times out
+func (rc ReadinessCondition) wait(ctx context.Context) error {
+	timeout := rc.Timeout
+	if timeout == 0 {
+		timeout = waitForReadinessTimeout
+	}
+	interval := rc.Interval
+	if interval == 0 {
+		interval = defaultReadinessInterval
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	for {
+		err := rc.check(ctx)
+		if err == nil {
+			return nil
+		}
+		// Report why the last check that ran to completion failed, rather than it being interrupted by the timeout
+		if ctx.Err() == nil || lastErr == nil {
+			lastErr = err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), lastErr)
+		}
+	}
+}
+
+func (rc ReadinessCondition) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	switch {
+	case rc.File != "":
+		_, err := os.Stat(rc.File)
+		return err
+
+	case rc.TCP != "":
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", rc.TCP)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case rc.HTTP != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rc.HTTP, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := readinessHTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status: %s", resp.Status)
+		}
+		return nil
+
+	default:
+		c := cmd.New(ctx, rc.Exec, false, "")
+		if err := c.Start(); err != nil {
+			return err
+		}
+		return c.Wait()
+	}
+}
+
+// waitForReadinessConditions waits for all the readiness conditions concurrently.
+// The first condition that wasn't met, in the order they are configured, is returned.
+func (o *Orchestrator) waitForReadinessConditions(ctx context.Context) (err error) {
+	ctx, span := o11y.StartSpan(ctx, "orchestrator: wait-for-readiness-conditions")
+	defer o11y.End(span, &err)
+
+	conditions := o.config.ReadinessConditions
+	span.AddField("count", len(conditions))
+
+	durations := make([]time.Duration, len(conditions))
+	errs := make([]error, len(conditions))
+
+	var wg sync.WaitGroup
+	for i, rc := range conditions {
+		wg.Go(func() {
+			start := time.Now()
+			errs[i] = rc.wait(ctx)
+			durations[i] = time.Since(start)
+		})
+	}
+	wg.Wait()
+
+	slowest := 0
+	for i := range conditions {
+		if durations[i] > durations[slowest] {
+			slowest = i
+		}
+	}
+	span.AddField("slowest", conditions[slowest].name())
+	span.AddField("slowest_duration_ms", durations[slowest].Milliseconds())
+
+	for i, rc := range conditions {
+		if errs[i] != nil {
+			span.AddField("failed", rc.name())
+			return fmt.Errorf("readiness condition %q was not met: %w", rc.name(), errs[i])
+		}
+	}
+
+	return nil
+}
@@ -18,6 +18,46 @@ type Config struct {
 	ReadinessFilePath   string   `json:"readiness_file_path"`
 	EnableUnsafeRetries bool     `json:"enable_unsafe_retries"`
 
+	// RetryPolicy overrides how each kind of task error is handled, such as retrying tasks if the Pod is evicted
+	RetryPolicy RetryPolicy `json:"retry_policy"`
+
+	// ReadinessContainers are the service containers that must each signal they're ready
+	// with a marker in the ReadinessDir before the task agent is started
+	ReadinessDir        string   `json:"readiness_dir"`
+	ReadinessContainers []string `json:"readiness_containers"`
+
+	// ReadinessConditions must all be met before the task agent is started
+	ReadinessConditions []ReadinessCondition `json:"readiness_conditions"`
+
+	// EntrypointPolicy is what to do if the custom entrypoint exits with an error during the task,
+	// with EntrypointMaxRestarts limiting the "restart" policy
+	EntrypointPolicy      EntrypointPolicy `json:"entrypoint_policy"`
+	EntrypointMaxRestarts int              `json:"entrypoint_max_restarts"`
+
+	// BackgroundProcesses are started in order before the task agent, and stopped in reverse order after it
+	BackgroundProcesses []BackgroundProcess `json:"background_processes"`
+
+	// HeartbeatInterval is how often to send heartbeats to the runner API while the task runs, if set
+	HeartbeatInterval time.Duration `json:"heartbeat_interval"`
+
+	// ReportLifecycleEvents enables sending lifecycle events for each phase of the task to the runner API
+	ReportLifecycleEvents bool `json:"report_lifecycle_events"`
+
+	// StateDir is where pending runner API events are journaled, so they can be replayed if the orchestrator is
+	// killed before they are sent, and where the progress of the task is recorded, so it isn't run twice if the
+	// orchestrator's container is restarted. It should be on a volume that outlives the orchestrator's container.
+	StateDir string `json:"state_dir"`
+
+	// TerminationMessagePath is where a summary of any task error is written on exit (e.g., /dev/termination-log)
+	TerminationMessagePath string `json:"termination_message_path"`
+
+	// AgentTerminationSignal is sent to the task agent's process group when the task is cancelled (e.g., "SIGTERM"),
+	// before it is killed after the AgentTerminationGracePeriod. If the orchestrator is interrupted, it is sent at
+	// the start of the termination grace period. The task agent is killed immediately if unset.
+	// The AgentTerminationGracePeriod defaults to, and is bounded by, the orchestrator's termination grace period.
+	AgentTerminationSignal      string        `json:"agent_termination_signal"`
+	AgentTerminationGracePeriod time.Duration `json:"agent_termination_grace_period"`
+
 	// Task agent configuration
 	Token            secret.String `json:"token"`
 	TaskAgentPath    string        `json:"task_agent_path"`
@@ -25,6 +65,10 @@ type Config struct {
 	Allocation       string        `json:"allocation"`
 	SSHAdvertiseAddr string        `json:"ssh_advertise_addr"`
 	MaxRunTime       time.Duration `json:"max_run_time"`
+
+	// MaxRunTimeSlack is how long the task agent can run past the MaxRunTime before the orchestrator stops it,
+	// which defaults to 5 minutes
+	MaxRunTimeSlack time.Duration `json:"max_run_time_slack"`
 }
 
 func (c *Config) UnmarshalJSON(b []byte) error {
@@ -35,6 +79,28 @@ func (c *Config) UnmarshalJSON(b []byte) error {
 		return fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if err := tc.EntrypointPolicy.validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := tc.RetryPolicy.validate(tc.AgentTerminationSignal != ""); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := validateBackgroundProcesses(tc.BackgroundProcesses); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if len(tc.ReadinessContainers) > 0 && tc.ReadinessDir == "" {
+		return fmt.Errorf("invalid config: readiness_dir is required with readiness_containers")
+	}
+
+	for _, rc := range tc.ReadinessConditions {
+		if err := rc.validate(); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+	}
+
 	*c = Config(tc)
 
 	return nil
@@ -49,6 +49,56 @@ func Test_UnmarshalJSON(t *testing.T) {
 				MaxRunTime:        time.Duration(60000000000),
 			},
 		},
+		{
+			name:      "unknown entrypoint policy",
+			rawConfig: `{"entrypoint_policy": "sometimes"}`,
+			wantError: `invalid config: unknown entrypoint policy "sometimes"`,
+		},
+		{
+			name:      "unknown error kind in retry policy",
+			rawConfig: `{"retry_policy": {"gremlins": "retry"}}`,
+			wantError: `invalid config: unknown error kind "gremlins" in retry policy`,
+		},
+		{
+			name:      "unknown retry action",
+			rawConfig: `{"retry_policy": {"oom": "ignore"}}`,
+			wantError: `invalid config: unknown retry action "ignore" for "oom" errors`,
+		},
+		{
+			name:      "task agent can't report if it never started",
+			rawConfig: `{"retry_policy": {"agent-start-failed": "let-agent-report"}}`,
+			wantError: `invalid config: retry action "let-agent-report" can't be used for "agent-start-failed" errors`,
+		},
+		{
+			name:      "task agent can't report an interruption without being signalled",
+			rawConfig: `{"retry_policy": {"pod-evicted": "let-agent-report"}}`,
+			wantError: `invalid config: retry action "let-agent-report" can't be used for "pod-evicted" errors ` +
+				`without an agent termination signal`,
+		},
+		{
+			name:      "task agent can report an interruption once signalled",
+			rawConfig: `{"retry_policy": {"pod-evicted": "let-agent-report"}, "agent_termination_signal": "SIGTERM"}`,
+		},
+		{
+			name:      "task agent can't report once it was killed",
+			rawConfig: `{"retry_policy": {"oom": "let-agent-report"}}`,
+			wantError: `invalid config: retry action "let-agent-report" can't be used for "oom" errors`,
+		},
+		{
+			name:      "duplicate background process",
+			rawConfig: `{"background_processes": [{"name": "proxy", "cmd": ["proxy"]}, {"name": "proxy", "cmd": ["proxy"]}]}`,
+			wantError: `invalid config: duplicate background process "proxy"`,
+		},
+		{
+			name:      "readiness condition with several checks",
+			rawConfig: `{"readiness_conditions": [{"name": "db", "tcp": "localhost:5432", "file": "/ready"}]}`,
+			wantError: `invalid config: readiness condition "db" must have exactly one of file, tcp, http or exec`,
+		},
+		{
+			name:      "readiness containers without a directory",
+			rawConfig: `{"readiness_containers": ["redis"]}`,
+			wantError: "invalid config: readiness_dir is required with readiness_containers",
+		},
 		{
 			name:      "invalid",
 			rawConfig: `not a valid JSON string`,
@@ -0,0 +1,49 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/circleci/ex/o11y"
+)
+
+type phase string
+
+const (
+	phaseWaitingForReadiness phase = "waiting-for-readiness"
+	phaseRunning             phase = "running"
+	phaseDraining            phase = "draining"
+)
+
+func (o *Orchestrator) setPhase(ctx context.Context, p phase) {
+	o.phase.Store(p)
+	o.recordState(ctx, func(s *attemptState) {
+		s.Phase = p
+	})
+}
+
+// heartbeat periodically reports the task is still alive to the runner API until the context is cancelled,
+// so upstream can tell if the Pod is frozen or partitioned well before the task would otherwise time out
+func (o *Orchestrator) heartbeat(ctx context.Context) {
+	interval := o.config.HeartbeatInterval
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		o.sendHeartbeat(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (o *Orchestrator) sendHeartbeat(ctx context.Context) {
+	p, _ := o.phase.Load().(phase)
+	if err := o.runnerClient.Heartbeat(ctx, time.Now(), o.config.Allocation, string(p)); err != nil && ctx.Err() == nil {
+		o11y.LogError(ctx, "failed to send heartbeat", err, o11y.Field("phase", p))
+	}
+}
@@ -0,0 +1,93 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/circleci/ex/o11y"
+
+	"github.com/circleci/runner-init/task/cmd"
+	"github.com/circleci/runner-init/task/taskerrors"
+)
+
+type interruptCause string
+
+const (
+	// interruptSignal is a termination signal, which the kubelet sends when the Pod is evicted or deleted
+	interruptSignal interruptCause = "signal"
+	// interruptMaxRunTime is the orchestrator being stopped after the task agent exceeded the maximum run time
+	interruptMaxRunTime interruptCause = "max-run-time"
+	// interruptInternal is the orchestrator being stopped for any other reason, such as a failed service
+	interruptInternal interruptCause = "internal"
+)
+
+// signalDeliveryTimeout allows for a termination signal being delivered to the orchestrator
+// just after the context cancellation it caused
+const signalDeliveryTimeout = 100 * time.Millisecond
+
+// interruption records why the orchestrator was interrupted before the task completed
+type interruption struct {
+	cause  interruptCause
+	signal syscall.Signal
+	err    error
+	// sinceAgentStart is how long the task agent had been running, if it had started
+	sinceAgentStart time.Duration
+	agentStarted    bool
+}
+
+// interruption works out why the orchestrator was interrupted, once the parent context is done
+func (o *Orchestrator) interruption(parentCtx context.Context) interruption {
+	in := interruption{
+		cause: interruptInternal,
+		err:   context.Cause(parentCtx),
+	}
+	if startedAt, ok := o.agentStartedAt.Load().(time.Time); ok {
+		in.agentStarted = true
+		in.sinceAgentStart = time.Since(startedAt)
+	}
+
+	select {
+	case sig := <-o.signals:
+		if s, ok := sig.(syscall.Signal); ok {
+			in.cause = interruptSignal
+			in.signal = s
+			return in
+		}
+	case <-time.After(signalDeliveryTimeout):
+	}
+
+	if o.maxRunTimeExceeded.Load() {
+		in.cause = interruptMaxRunTime
+	}
+	return in
+}
+
+func (in interruption) addFields(span o11y.Span) {
+	span.AddField("interrupt_cause", in.cause)
+	if in.cause == interruptSignal {
+		span.AddField("interrupt_signal", cmd.SignalName(in.signal))
+	}
+	if in.agentStarted {
+		span.AddField("interrupt_since_agent_start_ms", in.sinceAgentStart.Milliseconds())
+	}
+}
+
+// stillRunningError states why the task agent is still running when the orchestrator shuts down
+func (in interruption) stillRunningError(maxRunTime time.Duration) error {
+	switch in.cause {
+	case interruptSignal:
+		return taskerrors.WithKind(taskerrors.KindPodEvicted,
+			fmt.Errorf("task agent process is still running after the orchestrator received %s, "+
+				"which means the Pod is being evicted or deleted", cmd.SignalName(in.signal)))
+	case interruptMaxRunTime:
+		return taskerrors.WithKind(taskerrors.KindMaxRunTime,
+			fmt.Errorf("task agent process is still running after exceeding the maximum run time of %s",
+				maxRunTime))
+	default:
+		return taskerrors.WithKind(taskerrors.KindInterrupted,
+			fmt.Errorf("task agent process is still running after the orchestrator was stopped "+
+				"before the task completed: %v", in.err))
+	}
+}
@@ -0,0 +1,107 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/circleci/ex/o11y"
+
+	"github.com/circleci/runner-init/clients/runner"
+)
+
+type lifecycleEvent string
+
+const (
+	lifecycleStarted      lifecycleEvent = "started"
+	lifecycleReady        lifecycleEvent = "ready"
+	lifecycleAgentStarted lifecycleEvent = "agent-started"
+	lifecycleAgentExited  lifecycleEvent = "agent-exited"
+	lifecycleDraining     lifecycleEvent = "draining"
+)
+
+const (
+	lifecycleBufferSize = 16
+	// lifecycleFlushTimeout bounds how long the orchestrator waits on shutdown for pending events to be sent
+	lifecycleFlushTimeout = 5 * time.Second
+)
+
+type timestampedEvent struct {
+	event     lifecycleEvent
+	timestamp time.Time
+}
+
+// lifecycleReporter sends lifecycle events to the runner API in the background.
+// Emitting an event never blocks, so a slow runner API can't delay the task. Events are dropped if the buffer is full.
+type lifecycleReporter struct {
+	client     *runner.Client
+	allocation string
+	events     chan timestampedEvent
+	flush      chan struct{}
+	done       chan struct{}
+}
+
+func newLifecycleReporter(ctx context.Context, client *runner.Client, allocation string) *lifecycleReporter {
+	r := &lifecycleReporter{
+		client:     client,
+		allocation: allocation,
+		events:     make(chan timestampedEvent, lifecycleBufferSize),
+		flush:      make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go r.send(ctx)
+	return r
+}
+
+// emit queues the event, which is a no-op on a nil reporter so reporting can be disabled
+func (r *lifecycleReporter) emit(ctx context.Context, event lifecycleEvent) {
+	if r == nil {
+		return
+	}
+
+	select {
+	case r.events <- timestampedEvent{event: event, timestamp: time.Now()}:
+	default:
+		o11y.Log(ctx, "dropped lifecycle event", o11y.Field("event", event))
+	}
+}
+
+// close waits a bounded amount of time for pending events to be sent.
+// Any events emitted afterward, such as by a task agent that is still draining, are discarded.
+func (r *lifecycleReporter) close() {
+	if r == nil {
+		return
+	}
+
+	close(r.flush)
+	select {
+	case <-r.done:
+	case <-time.After(lifecycleFlushTimeout):
+	}
+}
+
+func (r *lifecycleReporter) send(ctx context.Context) {
+	defer close(r.done)
+
+	for {
+		select {
+		case e := <-r.events:
+			r.sendEvent(ctx, e)
+		case <-r.flush:
+			for {
+				select {
+				case e := <-r.events:
+					r.sendEvent(ctx, e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *lifecycleReporter) sendEvent(ctx context.Context, e timestampedEvent) {
+	err := r.client.LifecycleEvent(ctx, e.timestamp, r.allocation, string(e.event))
+	if err != nil {
+		o11y.LogError(ctx, "failed to send lifecycle event", err, o11y.Field("event", e.event))
+	}
+}
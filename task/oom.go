@@ -0,0 +1,100 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/circleci/ex/o11y"
+
+	"github.com/circleci/runner-init/internal/bytesize"
+)
+
+// cgroupDir is the cgroup v2 directory of the task container, which is the root of the cgroup namespace.
+// This can be overridden in tests.
+var cgroupDir = "/sys/fs/cgroup"
+
+// oomWatcher detects OOM kills in the container's cgroup by comparing the counters in `memory.events`
+// against those from when the task started
+type oomWatcher struct {
+	dir     string
+	oomKill uint64
+}
+
+// newOOMWatcher snapshots the OOM counters of the cgroup.
+// A nil watcher is returned if cgroup v2 memory accounting isn't available, such as on Windows or cgroup v1.
+func newOOMWatcher(ctx context.Context, dir string) *oomWatcher {
+	events, err := readMemoryEvents(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			o11y.LogError(ctx, "failed to read cgroup memory events", err, o11y.Field("dir", dir))
+		}
+		return nil
+	}
+
+	return &oomWatcher{dir: dir, oomKill: events["oom_kill"]}
+}
+
+// killed checks if any processes in the cgroup were OOM killed since the watcher was created
+func (w *oomWatcher) killed() (bool, error) {
+	if w == nil {
+		return false, nil
+	}
+
+	events, err := readMemoryEvents(w.dir)
+	if err != nil {
+		return false, err
+	}
+
+	return events["oom_kill"] > w.oomKill, nil
+}
+
+// memoryLimit returns a human-readable memory limit of the cgroup
+func (w *oomWatcher) memoryLimit() string {
+	b, err := os.ReadFile(filepath.Join(w.dir, "memory.max")) //#nosec:G304 // this is trusted input
+	if err != nil {
+		return "unknown"
+	}
+
+	limit, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		// The limit is "max" if the container is unbounded, in which case the node ran out of memory
+		return "unbounded"
+	}
+	return bytesize.Format(limit)
+}
+
+func readMemoryEvents(dir string) (map[string]uint64, error) {
+	f, err := os.Open(filepath.Join(dir, "memory.events")) //#nosec:G304 // this is trusted input
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	events := map[string]uint64{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), " ")
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed memory event %q: %w", s.Text(), err)
+		}
+		events[key] = n
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/circleci/ex/o11y"
@@ -14,6 +17,7 @@ import (
 
 	"github.com/circleci/runner-init/clients/runner"
 	"github.com/circleci/runner-init/task/cmd"
+	"github.com/circleci/runner-init/task/readiness"
 	"github.com/circleci/runner-init/task/taskerrors"
 )
 
@@ -23,10 +27,30 @@ type Orchestrator struct {
 	gracePeriod  time.Duration
 
 	ready      atomic.Bool
+	phase      atomic.Value
 	entrypoint cmd.Command
 	taskAgent  cmd.Command
-	reaper     cmd.Reaper
-	cancelTask context.CancelFunc
+	background []*backgroundProcess
+	lifecycle  *lifecycleReporter
+	outbox     *outbox
+	state      *stateFile
+
+	// agentStartedAt is when the task agent was started, if it has been
+	agentStartedAt atomic.Value
+	// maxRunTimeExceeded is set once the task agent has run for longer than the maximum run time
+	maxRunTimeExceeded atomic.Bool
+	// terminationDeadline is when the termination grace period is over, once the orchestrator is interrupted
+	terminationDeadline atomic.Value
+	reaper              cmd.Reaper
+	cancelTask          context.CancelFunc
+	// stopAgent stops the task agent, without stopping the rest of the task
+	stopAgent context.CancelFunc
+	// agentStopDeadline is when the task agent's termination grace period is over, once it has been stopped
+	agentStopDeadline time.Time
+
+	// signals receives termination signals, so the cause of an interruption is known
+	signals     chan os.Signal
+	interrupted *interruption
 }
 
 var (
@@ -35,6 +59,18 @@ var (
 	waitForReadinessTimeout = 10 * time.Minute
 )
 
+var errMaxRunTimeExceeded = errors.New("maximum run time exceeded")
+
+const (
+	// defaultMaxRunTimeSlack gives the task agent a chance to enforce the maximum run time itself
+	defaultMaxRunTimeSlack = 5 * time.Minute
+
+	// maxReportingTimeout bounds how long handling an error can spend sending each runner API event, including retries
+	maxReportingTimeout = 1 * time.Minute
+	// minReportingTimeout still allows an attempt if the termination grace period is already over
+	minReportingTimeout = 5 * time.Second
+)
+
 func NewOrchestrator(config Config, runnerClient *runner.Client, gracePeriod time.Duration) *Orchestrator {
 	if runnerClient == nil {
 		panic("runner API client is unset")
@@ -51,37 +87,100 @@ func NewOrchestrator(config Config, runnerClient *runner.Client, gracePeriod tim
 func (o *Orchestrator) Run(parentCtx context.Context) (err error) {
 	parentCtx, span := o11y.StartSpan(parentCtx, "run-task")
 
+	var resumeErr error
+	if o.config.StateDir != "" {
+		var done bool
+		// Don't let an interruption stop undelivered events being replayed
+		done, resumeErr = o.resumeTask(context.WithoutCancel(parentCtx))
+		if done {
+			o11y.End(span, &err)
+			return nil
+		}
+	}
+
 	ctx := o.taskContext(parentCtx)
 	o.reaper.Enable(ctx)
 
+	o.signals = make(chan os.Signal, 1)
+	signal.Notify(o.signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(o.signals)
+
+	stopDeadline := context.AfterFunc(parentCtx, func() {
+		o.terminationDeadline.Store(time.Now().Add(o.gracePeriod))
+	})
+	defer stopDeadline()
+
 	defer func() {
 		err = o.shutdown(ctx, err)
 		o11y.End(span, &err)
 	}()
 
+	if resumeErr != nil {
+		return resumeErr
+	}
+
+	if o.config.ReportLifecycleEvents {
+		o.lifecycle = newLifecycleReporter(ctx, o.runnerClient, o.config.Allocation)
+	}
+	o.lifecycle.emit(ctx, lifecycleStarted)
+
+	o.setPhase(ctx, phaseWaitingForReadiness)
+	if o.config.HeartbeatInterval > 0 {
+		heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+		defer stopHeartbeat()
+		go o.heartbeat(heartbeatCtx)
+	}
+
+	var entrypointErrCh chan error
+	prepareCtx := ctx
 	if len(o.config.Cmd) > 0 {
 		// If a custom entrypoint is specified, execute it in the background
 		if err := o.executeEntrypoint(ctx); err != nil {
 			return err
 		}
+
+		// Stop preparing the task if the entrypoint fails, so the task agent isn't started without it
+		var entrypointFailed context.CancelCauseFunc
+		prepareCtx, entrypointFailed = context.WithCancelCause(ctx)
+
+		entrypointErrCh = make(chan error, 1)
+		go func() {
+			if err := o.superviseEntrypoint(ctx); err != nil {
+				entrypointErrCh <- err
+				entrypointFailed(err)
+			}
+		}()
 	}
 
 	// Signal the orchestrator is ready and will start the task agent process
 	o.ready.Store(true)
 
-	if len(o.config.ReadinessFilePath) > 0 {
-		// Wait for readiness from the other containers before starting the task agent process
-		if err := o.waitForReadiness(ctx); err != nil {
-			return taskerrors.RetryableErrorf("error waiting for service containers to become ready: %w", err)
-		}
+	prepareErr := o.prepareTask(prepareCtx)
+	select {
+	case err := <-entrypointErrCh:
+		// The task agent won't be started, so stop any background processes that were
+		o.stopBackgroundProcesses(ctx)
+		return err
+	default:
+	}
+	if prepareErr != nil {
+		return prepareErr
 	}
 
+	o.setPhase(ctx, phaseRunning)
+	o.lifecycle.emit(ctx, lifecycleReady)
+
+	var agentCtx context.Context
+	agentCtx, o.stopAgent = context.WithCancel(ctx)
+
 	errCh := make(chan error, 1)
 	go func() {
 		// Start process reaping once the task agent process has completed
 		defer o.reaper.Start()
+		// But first stop the background processes, so they're waited on by Go exec rather than the reaper
+		defer o.stopBackgroundProcesses(ctx)
 
-		if err := o.executeAgent(ctx); err != nil {
+		if err := o.executeAgent(agentCtx); err != nil {
 			errCh <- fmt.Errorf("error while executing task agent: %w", err)
 			return
 		}
@@ -90,10 +189,32 @@ func (o *Orchestrator) Run(parentCtx context.Context) (err error) {
 
 	select {
 	case err := <-errCh:
+		// The entrypoint failing is the more likely cause if the task agent failed at the same time
+		select {
+		case entrypointErr := <-entrypointErrCh:
+			return errors.Join(entrypointErr, err)
+		default:
+			return err
+		}
+	case err := <-entrypointErrCh:
 		return err
 	case <-parentCtx.Done():
 		// If the parent context is cancelled, wait for the termination grace period before shutting down.
 		// This is in case the task completes within that period.
+		o.setPhase(ctx, phaseDraining)
+		o.lifecycle.emit(ctx, lifecycleDraining)
+
+		in := o.interruption(parentCtx)
+		o.interrupted = &in
+		in.addFields(span)
+		o11y.Log(ctx, "orchestrator interrupted", o11y.Field("cause", in.cause),
+			o11y.Field("since_agent_start", in.sinceAgentStart))
+
+		if o.config.AgentTerminationSignal != "" {
+			// Signal the task agent now, so it has the termination grace period to report its own cancellation
+			o.agentStopDeadline = time.Now().Add(o.agentTerminationGracePeriod())
+			o.stopAgent()
+		}
 		select {
 		case err := <-errCh:
 			return err
@@ -104,6 +225,39 @@ func (o *Orchestrator) Run(parentCtx context.Context) (err error) {
 	}
 }
 
+// prepareTask waits for the task to become ready and starts the background processes, before the task agent is started
+func (o *Orchestrator) prepareTask(ctx context.Context) error {
+	if len(o.config.ReadinessFilePath) > 0 {
+		// Wait for readiness from the other containers before starting the task agent process
+		if err := o.waitForReadiness(ctx); err != nil {
+			return taskerrors.WithKind(taskerrors.KindReadinessTimeout,
+				taskerrors.RetryableErrorf("error waiting for service containers to become ready: %w", err))
+		}
+	}
+
+	if len(o.config.ReadinessContainers) > 0 {
+		if err := o.waitForContainers(ctx); err != nil {
+			return taskerrors.WithKind(taskerrors.KindReadinessTimeout,
+				taskerrors.RetryableErrorf("error waiting for service containers to become ready: %w", err))
+		}
+	}
+
+	if len(o.config.ReadinessConditions) > 0 {
+		if err := o.waitForReadinessConditions(ctx); err != nil {
+			return taskerrors.WithKind(taskerrors.KindReadinessTimeout,
+				taskerrors.RetryableErrorf("error waiting for the task to become ready: %w", err))
+		}
+	}
+
+	if len(o.config.BackgroundProcesses) > 0 {
+		if err := o.startBackgroundProcesses(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (o *Orchestrator) taskContext(ctx context.Context) context.Context {
 	// Copy the O11y provider to a new context that can be separately cancelled.
 	// This ensures we can drain the task on shutdown of the agent even if the parent context was cancelled,
@@ -158,38 +312,198 @@ func (o *Orchestrator) waitForReadiness(ctx context.Context) (err error) {
 	}
 }
 
+// waitForContainers waits for a readiness marker from each of the service containers
+func (o *Orchestrator) waitForContainers(ctx context.Context) (err error) {
+	ctx, span := o11y.StartSpan(ctx, "orchestrator: wait-for-containers")
+	defer o11y.End(span, &err)
+
+	containers := o.config.ReadinessContainers
+	span.AddField("containers", len(containers))
+
+	ctx, cancel := context.WithTimeout(ctx, waitForReadinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	ready := 0
+	err = readiness.Wait(ctx, o.config.ReadinessDir, containers, func(name string) {
+		ready++
+		o11y.Log(ctx, "service container is ready",
+			o11y.Field("container", name),
+			o11y.Field("ready", fmt.Sprintf("%d/%d", ready, len(containers))),
+			o11y.Field("waited", time.Since(start).String()),
+		)
+	})
+	span.AddField("ready", ready)
+
+	var notReady readiness.NotReadyError
+	if errors.As(err, &notReady) {
+		span.AddField("not_ready", notReady.Missing)
+		return fmt.Errorf("containers never became ready: %s: %w",
+			strings.Join(notReady.Missing, ", "), notReady.Unwrap())
+	}
+	return err
+}
+
 func (o *Orchestrator) executeEntrypoint(ctx context.Context) error {
 	c := o.config.Cmd
 	o.entrypoint = cmd.New(ctx, c, true, "")
 
 	if err := o.entrypoint.Start(); err != nil {
-		return fmt.Errorf("error starting custom entrypoint %s: %w", c, err)
+		return taskerrors.WithKind(taskerrors.KindEntrypointFailed,
+			fmt.Errorf("error starting custom entrypoint %s: %w", c, err))
 	}
 	return nil
 }
 
-func (o *Orchestrator) executeAgent(ctx context.Context) error {
+func (o *Orchestrator) executeAgent(ctx context.Context) (err error) {
+	ctx, span := o11y.StartSpan(ctx, "orchestrator: execute-agent")
+	defer o11y.End(span, &err)
+
 	cfg := o.config
 	agent := cfg.Agent()
 
+	// The task agent should enforce the maximum run time itself, but stop it in case it hangs
+	if cfg.MaxRunTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, cfg.MaxRunTime+o.maxRunTimeSlack(), errMaxRunTimeExceeded)
+		defer cancel()
+	}
+
 	o.taskAgent = cmd.New(ctx, agent.Cmd, false, cfg.User, agent.Env...)
+	o.taskAgent.SetTermination(o.agentTermination(ctx))
+	oom := newOOMWatcher(ctx, cgroupDir)
 
 	if err := o.taskAgent.StartWithStdin([]byte(cfg.Token.Raw())); err != nil {
-		return taskerrors.RetryableErrorf("failed to start task agent command: %w", err)
+		return taskerrors.WithKind(taskerrors.KindAgentStartFailed,
+			taskerrors.RetryableErrorf("failed to start task agent command: %w", err))
+	}
+	startedAt := time.Now()
+	o.agentStartedAt.Store(startedAt)
+	o.recordState(ctx, func(s *attemptState) {
+		s.AgentPID = o.taskAgent.Pid()
+		s.AgentStartedAt = &startedAt
+	})
+	o.lifecycle.emit(ctx, lifecycleAgentStarted)
+
+	if cfg.MaxRunTime > 0 {
+		exceeded := time.AfterFunc(cfg.MaxRunTime, func() {
+			o.maxRunTimeExceeded.Store(true)
+		})
+		defer exceeded.Stop()
+	}
+
+	err = o.taskAgent.Wait()
+	o.lifecycle.emit(ctx, lifecycleAgentExited)
+
+	status, ok := o.taskAgent.ExitStatus()
+	if ok {
+		addExitStatusFields(span, status)
+		o.recordState(ctx, func(s *attemptState) {
+			s.AgentExit = &agentExit{ExitedAt: time.Now(), ExitCode: status.ExitCode}
+			if status.Signaled() {
+				s.AgentExit.Signal = cmd.SignalName(status.Signal)
+			}
+		})
+	}
+
+	// This is reported even if the task agent shut down gracefully, since it failed to enforce the maximum run time
+	if err != nil && errors.Is(context.Cause(ctx), errMaxRunTimeExceeded) {
+		span.AddField("max_run_time_exceeded", true)
+		return taskerrors.WithKind(taskerrors.KindMaxRunTime,
+			fmt.Errorf("task agent command was stopped after exceeding the maximum run time of %s by %s: %v",
+				cfg.MaxRunTime, o.maxRunTimeSlack(), err))
 	}
 
-	if err := o.taskAgent.Wait(); err != nil {
-		return fmt.Errorf("task agent command exited with an unexpected error: %v", err)
+	if err != nil && ok && status.ExitCode == 0 && ctx.Err() != nil {
+		// The task agent shut down gracefully after being stopped, so it will have reported its own cancellation
+		span.AddField("stopped_gracefully", true)
+		err = nil
+	}
+
+	if err != nil {
+		if oomKilled, oomErr := oom.killed(); oomErr != nil {
+			o11y.LogError(ctx, "failed to check for OOM kills", oomErr)
+		} else if oomKilled {
+			span.AddField("oom_killed", true)
+			return taskerrors.WithKind(taskerrors.KindOOM,
+				fmt.Errorf("task agent command was killed after the task container exceeded its memory limit "+
+					"(memory limit: %s): %v", oom.memoryLimit(), err))
+		}
+
+		// The task agent doesn't kill itself, so this is usually the kernel's OOM killer or the kubelet.
+		// Ignore our own kill of the process group on cancellation.
+		signaled := ok && status.Signaled() && ctx.Err() == nil
+		if signaled && status.Signal == syscall.SIGKILL {
+			return taskerrors.WithKind(taskerrors.KindAgentSignaled,
+				fmt.Errorf("task agent command was killed, which is likely due to it running out of memory "+
+					"or the Pod being evicted: %v", err))
+		}
+		err = fmt.Errorf("task agent command exited with an unexpected error: %v", err)
+		if signaled {
+			return taskerrors.WithKind(taskerrors.KindAgentSignaled, err)
+		}
+		return err
 	}
 
 	return nil
 }
 
+// maxRunTimeSlack is how long the task agent can run past the maximum run time before it is stopped
+func (o *Orchestrator) maxRunTimeSlack() time.Duration {
+	if o.config.MaxRunTimeSlack > 0 {
+		return o.config.MaxRunTimeSlack
+	}
+	return defaultMaxRunTimeSlack
+}
+
+// agentTermination is how the task agent is stopped on cancellation, giving it a chance to report
+// its own cancellation. The grace period is bounded by the orchestrator's termination grace period.
+func (o *Orchestrator) agentTermination(ctx context.Context) cmd.Termination {
+	name := o.config.AgentTerminationSignal
+	if name == "" {
+		return cmd.Termination{}
+	}
+
+	sig, err := cmd.ParseSignal(name)
+	if err != nil {
+		o11y.LogError(ctx, "ignoring the agent termination signal", err)
+		return cmd.Termination{}
+	}
+
+	return cmd.Termination{
+		Signal:      sig,
+		GracePeriod: o.agentTerminationGracePeriod(),
+	}
+}
+
+// agentTerminationGracePeriod defaults to the orchestrator's termination grace period, which also bounds it
+func (o *Orchestrator) agentTerminationGracePeriod() time.Duration {
+	if p := o.config.AgentTerminationGracePeriod; p > 0 {
+		return min(p, o.gracePeriod)
+	}
+	return o.gracePeriod
+}
+
+func addExitStatusFields(span o11y.Span, status cmd.ExitStatus) {
+	span.AddField("exit_code", status.ExitCode)
+	span.AddField("duration_ms", status.Duration.Milliseconds())
+	if status.Signaled() {
+		span.AddField("signal", cmd.SignalName(status.Signal))
+		span.AddField("core_dumped", status.CoreDumped)
+	}
+	if status.Stderr != "" {
+		span.AddField("stderr", status.Stderr)
+	}
+}
+
 func (o *Orchestrator) shutdown(ctx context.Context, runErr error) (err error) {
 	isRunning, err := o.taskAgent.IsRunning()
-	if isRunning {
-		err = fmt.Errorf("task agent process is still running, which could interrupt the task. " +
-			"Possible reasons include the Pod being evicted or deleted")
+	// The task agent is expected to still be running if the task failed for another reason, such as the entrypoint
+	switch {
+	case isRunning && runErr == nil && o.interrupted != nil:
+		err = o.interrupted.stillRunningError(o.config.MaxRunTime)
+	case isRunning && runErr == nil:
+		err = fmt.Errorf("task agent process is still running, which could interrupt the task")
 	}
 	if err != nil {
 		err = fmt.Errorf("error on shutdown: %w", err)
@@ -197,27 +511,86 @@ func (o *Orchestrator) shutdown(ctx context.Context, runErr error) (err error) {
 
 	err = errors.Join(err, runErr)
 	if err != nil {
-		err = o.handleErrors(ctx, err)
+		if o.retryAction(err) == RetryActionLetAgentReport {
+			o.waitForAgentToReport(ctx)
+		}
+
+		handledErr := o.handleErrors(ctx, err)
+		o.writeTerminationMessage(ctx, err, handledErr)
+		err = handledErr
 	}
 
+	o.recordState(ctx, func(s *attemptState) {
+		s.Phase = phaseCompleted
+	})
+	o.lifecycle.close()
+
+	if o.agentStopDeadline.IsZero() {
+		o.agentStopDeadline = time.Now().Add(o.agentTerminationGracePeriod())
+	}
 	o.cancelTask()
 
+	o.waitForAgent(ctx)
+
 	<-o.reaper.Done()
 
 	return err
 }
 
+// waitForAgentToReport leaves the task agent running until it exits by itself, so it isn't stopped before it has
+// reported the task. This is bounded by any maximum run time, or the termination grace period if interrupted.
+func (o *Orchestrator) waitForAgentToReport(ctx context.Context) {
+	if isRunning, _ := o.taskAgent.IsRunning(); !isRunning {
+		return
+	}
+
+	o11y.Log(ctx, "waiting for the task agent to report the task")
+	err := o.taskAgent.Wait()
+	o11y.Log(ctx, "task agent exited", o11y.Field("exit", err))
+}
+
+// waitForAgent waits for the task agent to exit once it has been stopped, until its termination grace period is over.
+// Otherwise, it is killed along with the orchestrator before it can shut down gracefully.
+func (o *Orchestrator) waitForAgent(ctx context.Context) {
+	if isRunning, _ := o.taskAgent.IsRunning(); !isRunning {
+		return
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		_ = o.taskAgent.Wait()
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+	case <-time.After(time.Until(o.agentStopDeadline)):
+		o11y.Log(ctx, "task agent is still running after the termination grace period")
+	}
+}
+
 func (o *Orchestrator) handleErrors(ctx context.Context, err error) error {
-	ctx = o11y.WithProvider(context.Background(), o11y.FromContext(ctx))
-	c := o.config
+	ctx, span := o11y.StartSpan(o11y.WithProvider(context.Background(), o11y.FromContext(ctx)),
+		"orchestrator: handle-errors")
+	defer span.End()
 
 	if err != nil {
 		err = fmt.Errorf("%w: Check container logs for more details", err)
 	}
 
+	code := taskerrors.CodeOf(err)
+	action := o.retryAction(err)
+	span.AddField("error_code", code)
+	span.AddField("retry_action", action)
+	if action == RetryActionLetAgentReport {
+		o11y.LogError(ctx, "leaving the task agent to report the error", err)
+		return taskerrors.NewHandledError(err)
+	}
+
 	var unclaimErr error
-	if errors.As(err, &taskerrors.RetryableError{}) || c.EnableUnsafeRetries {
-		unclaimErr = o.runnerClient.UnclaimTask(ctx, c.TaskID, c.Token)
+	if action == RetryActionRetry {
+		// Leave time to send the fail event if the task can't be retried
+		unclaimErr = o.sendEventWithin(ctx, o.reportingTimeout()/2, o.outbox.newEvent(outboxUnclaim, ""))
 		if unclaimErr == nil {
 			o11y.LogError(ctx, "retrying task after encountering a retryable error", err)
 			return nil
@@ -228,7 +601,9 @@ func (o *Orchestrator) handleErrors(ctx context.Context, err error) error {
 		unclaimErr = fmt.Errorf("failed to retry task: %w", unclaimErr)
 	}
 
-	failErr := o.runnerClient.FailTask(ctx, time.Now(), c.Allocation, err.Error())
+	fail := o.outbox.newEvent(outboxFail, err.Error())
+	fail.Code = code
+	failErr := o.sendEventWithin(ctx, o.reportingTimeout(), fail)
 	if failErr != nil {
 		failErr = fmt.Errorf("failed to send fail event for task: %w", failErr)
 		return errors.Join(failErr, unclaimErr, err)
@@ -237,6 +612,24 @@ func (o *Orchestrator) handleErrors(ctx context.Context, err error) error {
 	return taskerrors.NewHandledError(errors.Join(unclaimErr, err))
 }
 
+// sendEventWithin bounds the runner API client's retries of transient errors when sending the event.
+// Otherwise, they could outlive the termination grace period, and the container be killed before the task is failed.
+func (o *Orchestrator) sendEventWithin(ctx context.Context, timeout time.Duration, ev outboxEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return o.sendEvent(ctx, ev)
+}
+
+// reportingTimeout is how long is left to report an error to the runner API
+func (o *Orchestrator) reportingTimeout() time.Duration {
+	deadline, ok := o.terminationDeadline.Load().(time.Time)
+	if !ok {
+		return maxReportingTimeout
+	}
+	return min(max(time.Until(deadline), minReportingTimeout), maxReportingTimeout)
+}
+
 func (o *Orchestrator) HealthChecks() (_ string, ready, live func(ctx context.Context) error) {
 	return "orchestrator",
 		func(_ context.Context) error {
@@ -2,29 +2,39 @@ package task
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
 	"github.com/circleci/ex/testing/testcontext"
+	"github.com/goccy/go-json"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/assert/cmp"
 	"gotest.tools/v3/poll"
 
 	"github.com/circleci/runner-init/clients/runner"
 	"github.com/circleci/runner-init/internal/testing/fakerunnerapi"
+	"github.com/circleci/runner-init/task/cmd"
 	helpers "github.com/circleci/runner-init/task/internal/testing"
+	"github.com/circleci/runner-init/task/readiness"
+	"github.com/circleci/runner-init/task/taskerrors"
 )
 
 var testOnce sync.Once
@@ -42,6 +52,10 @@ func TestOrchestrator(t *testing.T) {
 		reapTimeout = 500 * time.Millisecond
 	})
 
+	// Make the idempotency keys of journaled events predictable
+	newIdempotencyKey = func() string { return "testkey" }
+	t.Cleanup(func() { newIdempotencyKey = rand.Text })
+
 	// Re-parent any child processes to us to simulate the orchestrator being init
 	helpers.ReparentChildren(t)
 
@@ -53,19 +67,21 @@ func TestOrchestrator(t *testing.T) {
 		Allocation:    "testalloc",
 	}
 	tests := []struct {
-		name string
+		name     string
+		unixOnly bool
 
 		config          Config
 		env             map[string]string
 		gracePeriod     time.Duration
 		timeout         time.Duration
 		additionalTasks []fakerunnerapi.Task
-		cleanup         func()
+		setup           func(t *testing.T)
 
 		wantError        string
 		wantTimeout      bool
 		wantTaskUnclaims []fakerunnerapi.TaskUnclaim
 		wantTaskEvents   []fakerunnerapi.TaskEvent
+		wantLifecycle    []string
 		extraChecks      []func(t *testing.T)
 	}{
 		{
@@ -75,6 +91,15 @@ func TestOrchestrator(t *testing.T) {
 			},
 			config: defaultConfig,
 		},
+		{
+			name: "lifecycle events",
+			config: func() Config {
+				c := defaultConfig
+				c.ReportLifecycleEvents = true
+				return c
+			}(),
+			wantLifecycle: []string{"started", "ready", "agent-started", "agent-exited"},
+		},
 		{
 			name: "custom entrypoint",
 			config: Config{
@@ -149,6 +174,144 @@ func TestOrchestrator(t *testing.T) {
 			}(),
 			wantError: "",
 		},
+		{
+			name: "error: custom entrypoint crashed",
+			config: func() Config {
+				c := defaultConfig
+				c.Cmd = []string{shell(t), "-c", "sleep 1; exit 3"}
+				c.EntrypointPolicy = EntrypointPolicyFailTask
+				return c
+			}(),
+			env: map[string]string{
+				"SIMULATE_RUNNING_A_TASK": "true",
+			},
+			wantError: "custom entrypoint [" + shell(t) + " -c sleep 1; exit 3] exited unexpectedly: exit status 3",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					Code:           "ENTRYPOINT_FAILED",
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("custom entrypoint [" + shell(t) + " -c sleep 1; exit 3] " +
+						"exited unexpectedly: exit status 3: Check container logs for more details"),
+				},
+			},
+		},
+		{
+			name: "error: custom entrypoint crashed before the task was ready",
+			config: func() Config {
+				c := defaultConfig
+				c.Cmd = []string{shell(t), "-c", "exit 3"}
+				c.EntrypointPolicy = EntrypointPolicyFailTask
+				c.ReadinessFilePath = filepath.Join(scratchDir, "never-ready")
+				c.ReportLifecycleEvents = true
+				return c
+			}(),
+			wantError: "custom entrypoint [" + shell(t) + " -c exit 3] exited unexpectedly: exit status 3",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					Code:           "ENTRYPOINT_FAILED",
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("custom entrypoint [" + shell(t) + " -c exit 3] " +
+						"exited unexpectedly: exit status 3: Check container logs for more details"),
+				},
+			},
+			// The task agent was never started
+			wantLifecycle: []string{"started"},
+		},
+		{
+			name: "error: custom entrypoint restarted until out of attempts",
+			setup: func(t *testing.T) {
+				override(t, &entrypointRestartBackoff, 10*time.Millisecond)
+			},
+			config: func() Config {
+				c := defaultConfig
+				restartsDir := filepath.Join(scratchDir, "restarts")
+				assert.NilError(t, os.MkdirAll(restartsDir, 0750))
+				c.Cmd = []string{shell(t), "-c", fmt.Sprintf("mktemp -p %s; exit 1", filepath.ToSlash(restartsDir))}
+				c.EntrypointPolicy = EntrypointPolicyRestart
+				c.EntrypointMaxRestarts = 2
+				return c
+			}(),
+			env: map[string]string{
+				"SIMULATE_RUNNING_A_TASK": "true",
+			},
+			wantError: "exited unexpectedly after 2 restarts: exit status 1",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					Code:           "ENTRYPOINT_FAILED",
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("custom entrypoint [" + shell(t) + " -c mktemp -p " +
+						filepath.ToSlash(filepath.Join(scratchDir, "restarts")) + "; exit 1] " +
+						"exited unexpectedly after 2 restarts: exit status 1: Check container logs for more details"),
+				},
+			},
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					entries, err := os.ReadDir(filepath.Join(scratchDir, "restarts"))
+					assert.NilError(t, err)
+					assert.Check(t, cmp.Len(entries, 3), "expected the entrypoint to run 3 times")
+				},
+			},
+		},
+		{
+			name: "background processes",
+			setup: func(t *testing.T) {
+				override(t, &backgroundReadinessInterval, 10*time.Millisecond)
+			},
+			config: func() Config {
+				c := defaultConfig
+				c.BackgroundProcesses = []BackgroundProcess{
+					{
+						Name:       "proxy",
+						Cmd:        []string{shell(t), "-c", "echo $GREETING > proxy; sleep 30"},
+						Env:        []string{"GREETING=hello"},
+						WorkingDir: scratchDir,
+					},
+					{
+						Name:         "exporter",
+						Cmd:          []string{shell(t), "-c", "sleep 0.5; touch exporter; sleep 30"},
+						WorkingDir:   scratchDir,
+						ReadinessCmd: []string{shell(t), "-c", "test -f exporter"},
+					},
+				}
+				return c
+			}(),
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					b, err := os.ReadFile(filepath.Join(scratchDir, "proxy")) //nolint:gosec // this is a test
+					assert.NilError(t, err)
+					assert.Check(t, cmp.Equal(strings.TrimSpace(string(b)), "hello"))
+
+					_, err = os.Stat(filepath.Join(scratchDir, "exporter"))
+					assert.NilError(t, err, "expected the task agent to wait for the exporter to be ready")
+				},
+			},
+		},
+		{
+			name: "error: background process exited before becoming ready",
+			config: func() Config {
+				c := defaultConfig
+				c.BackgroundProcesses = []BackgroundProcess{
+					{
+						Name:         "broken",
+						Cmd:          []string{shell(t), "-c", "exit 2"},
+						ReadinessCmd: []string{shell(t), "-c", "exit 1"},
+					},
+				}
+				return c
+			}(),
+			wantError: "error starting background process \"broken\": exited before becoming ready: exit status 2",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("error starting background process broken: exited before becoming ready: exit status 2: " +
+						"Check container logs for more details"),
+				},
+			},
+		},
 		{
 			name:   "error: interrupted task",
 			config: defaultConfig,
@@ -156,42 +319,493 @@ func TestOrchestrator(t *testing.T) {
 				"SIMULATE_RUNNING_A_TASK": "true",
 			},
 			timeout: 500 * time.Millisecond,
-			wantError: "error on shutdown: task agent process is still running, " +
-				"which could interrupt the task. Possible reasons include the Pod being evicted or deleted",
+			wantError: "error on shutdown: task agent process is still running after the orchestrator was stopped " +
+				"before the task completed: context deadline exceeded",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					Code:           "INTERRUPTED",
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("error on shutdown: task agent process is still running after the orchestrator " +
+						"was stopped before the task completed: context deadline exceeded: " +
+						"Check container logs for more details"),
+				},
+			},
+		},
+		{
+			name:     "interrupted task agent is signalled at the start of the grace period",
+			unixOnly: true,
+			config: func() Config {
+				c := defaultConfig
+				c.AgentTerminationSignal = "SIGTERM"
+				c.AgentTerminationGracePeriod = 5 * time.Second
+				return c
+			}(),
+			env: map[string]string{
+				"SIMULATE_GRACEFUL_SHUTDOWN": filepath.Join(scratchDir, "interrupted-agent-flushed"),
+			},
+			timeout:     1 * time.Second,
+			gracePeriod: 5 * time.Second,
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					_, err := os.Stat(filepath.Join(scratchDir, "interrupted-agent-flushed"))
+					assert.NilError(t, err, "expected the task agent to shut down gracefully")
+				},
+			},
+		},
+		{
+			name:     "error: shutdown waits for the stopped task agent",
+			unixOnly: true,
+			config: func() Config {
+				c := defaultConfig
+				c.Cmd = []string{shell(t), "-c", "sleep 1; exit 3"}
+				c.EntrypointPolicy = EntrypointPolicyFailTask
+				// The task agent gets the orchestrator's termination grace period
+				c.AgentTerminationSignal = "SIGTERM"
+				return c
+			}(),
+			env: map[string]string{
+				"SIMULATE_GRACEFUL_SHUTDOWN": filepath.Join(scratchDir, "stopped-agent-flushed"),
+			},
+			gracePeriod: 5 * time.Second,
+			wantError:   "custom entrypoint [" + shell(t) + " -c sleep 1; exit 3] exited unexpectedly: exit status 3",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					Code:           "ENTRYPOINT_FAILED",
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("custom entrypoint [" + shell(t) + " -c sleep 1; exit 3] " +
+						"exited unexpectedly: exit status 3: Check container logs for more details"),
+				},
+			},
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					_, err := os.Stat(filepath.Join(scratchDir, "stopped-agent-flushed"))
+					assert.NilError(t, err, "expected the orchestrator to wait for the task agent to shut down")
+				},
+			},
+		},
+		{
+			name:     "error: task agent was stopped after the maximum run time",
+			unixOnly: true,
+			config: func() Config {
+				c := defaultConfig
+				c.MaxRunTime = 200 * time.Millisecond
+				c.MaxRunTimeSlack = 100 * time.Millisecond
+				c.AgentTerminationSignal = "SIGTERM"
+				c.AgentTerminationGracePeriod = 5 * time.Second
+				c.TerminationMessagePath = filepath.Join(scratchDir, "max-run-time-termination-log")
+				return c
+			}(),
+			gracePeriod: 10 * time.Second,
+			env: map[string]string{
+				"SIMULATE_RUNNING_A_TASK": "true",
+			},
+			wantError: "error while executing task agent: task agent command was stopped after exceeding " +
+				"the maximum run time of 200ms by 100ms: signal: terminated",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					Code:           "MAX_RUN_TIME_EXCEEDED",
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("error while executing task agent: task agent command was stopped after exceeding " +
+						"the maximum run time of 200ms by 100ms: signal: terminated: Check container logs for more details"),
+				},
+			},
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					assertTerminationMessage(t, filepath.Join(scratchDir, "max-run-time-termination-log"),
+						terminationMessage{
+							Reason: "error while executing task agent: task agent command was stopped after exceeding " +
+								"the maximum run time of 200ms by 100ms: signal: terminated",
+							Class:       "fatal",
+							Code:        "MAX_RUN_TIME_EXCEEDED",
+							Outcome:     "infra-failed",
+							AgentSignal: "SIGTERM",
+						})
+				},
+			},
+		},
+		{
+			name:     "error: task agent shut down gracefully after the maximum run time",
+			unixOnly: true,
+			config: func() Config {
+				c := defaultConfig
+				c.MaxRunTime = 200 * time.Millisecond
+				c.MaxRunTimeSlack = 100 * time.Millisecond
+				c.AgentTerminationSignal = "SIGTERM"
+				return c
+			}(),
+			gracePeriod: 10 * time.Second,
+			env: map[string]string{
+				"SIMULATE_GRACEFUL_SHUTDOWN": filepath.Join(scratchDir, "max-run-time-agent-flushed"),
+			},
+			wantError: "error while executing task agent: task agent command was stopped after exceeding " +
+				"the maximum run time of 200ms by 100ms: context deadline exceeded",
 			wantTaskEvents: []fakerunnerapi.TaskEvent{
 				{
 					Allocation:     defaultConfig.Allocation,
+					Code:           "MAX_RUN_TIME_EXCEEDED",
 					TimestampMilli: time.Now().UnixMilli(),
-					Message: []byte("error on shutdown: task agent process is still running, " +
-						"which could interrupt the task. Possible reasons include the Pod being evicted or deleted: " +
+					Message: []byte("error while executing task agent: task agent command was stopped after exceeding " +
+						"the maximum run time of 200ms by 100ms: context deadline exceeded: " +
 						"Check container logs for more details"),
 				},
 			},
 		},
 		{
-			name:   "error: task agent encountered fatal error",
-			config: defaultConfig,
-			env: map[string]string{
-				"SIMULATE_FATAL_ERROR": "true",
+			name: "error: interrupted task exceeded the maximum run time",
+			config: func() Config {
+				c := defaultConfig
+				c.MaxRunTime = 100 * time.Millisecond
+				return c
+			}(),
+			env: map[string]string{
+				"SIMULATE_RUNNING_A_TASK": "true",
+			},
+			timeout: 500 * time.Millisecond,
+			wantError: "error on shutdown: task agent process is still running after exceeding " +
+				"the maximum run time of 100ms",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					Code:           "MAX_RUN_TIME_EXCEEDED",
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("error on shutdown: task agent process is still running after exceeding " +
+						"the maximum run time of 100ms: Check container logs for more details"),
+				},
+			},
+		},
+		{
+			name: "error: task agent encountered fatal error",
+			config: func() Config {
+				c := defaultConfig
+				c.TerminationMessagePath = filepath.Join(scratchDir, "fatal-termination-log")
+				return c
+			}(),
+			env: map[string]string{
+				"SIMULATE_FATAL_ERROR": "true",
+			},
+			wantError: "error while executing task agent: " +
+				"task agent command exited with an unexpected error: exit status 1",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("error while executing task agent: " +
+						"task agent command exited with an unexpected error: exit status 1: fatal!!!: " +
+						"Check container logs for more details"),
+				},
+			},
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					assertTerminationMessage(t, filepath.Join(scratchDir, "fatal-termination-log"), terminationMessage{
+						Reason: "error while executing task agent: " +
+							"task agent command exited with an unexpected error: exit status 1: fatal!!!",
+						Class:         "fatal",
+						Outcome:       "infra-failed",
+						AgentExitCode: ptr(1),
+					})
+				},
+			},
+		},
+		{
+			name:     "error: task agent was killed",
+			unixOnly: true,
+			config:   defaultConfig,
+			env: map[string]string{
+				"SIMULATE_KILLED": "true",
+			},
+			wantError: "error while executing task agent: task agent command was killed, " +
+				"which is likely due to it running out of memory or the Pod being evicted: signal: killed",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					Code:           "AGENT_SIGNALLED",
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("error while executing task agent: task agent command was killed, " +
+						"which is likely due to it running out of memory or the Pod being evicted: signal: killed: " +
+						"Check container logs for more details"),
+				},
+			},
+		},
+		{
+			name:     "retry policy: killed task agent is retried",
+			unixOnly: true,
+			config: func() Config {
+				c := defaultConfig
+				c.TaskID = "signaled"
+				c.RetryPolicy = RetryPolicy{taskerrors.KindAgentSignaled: RetryActionRetry}
+				return c
+			}(),
+			env: map[string]string{
+				"SIMULATE_KILLED": "true",
+			},
+			wantTaskUnclaims: []fakerunnerapi.TaskUnclaim{
+				{
+					ID:    "signaled",
+					Token: defaultConfig.Token.Raw(),
+				},
+			},
+		},
+		{
+			name: "retry policy: crashed entrypoint is left to the task agent to report",
+			config: func() Config {
+				c := defaultConfig
+				c.Cmd = []string{shell(t), "-c", "sleep 1; exit 3"}
+				c.EntrypointPolicy = EntrypointPolicyFailTask
+				c.RetryPolicy = RetryPolicy{taskerrors.KindEntrypointFailed: RetryActionLetAgentReport}
+				c.TerminationMessagePath = filepath.Join(scratchDir, "left-to-agent-termination-log")
+				return c
+			}(),
+			env: map[string]string{
+				"SIMULATE_REPORTING": filepath.Join(scratchDir, "agent-reported"),
+			},
+			wantError: "handled: custom entrypoint [" + shell(t) + " -c sleep 1; exit 3] exited unexpectedly",
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					_, err := os.Stat(filepath.Join(scratchDir, "agent-reported"))
+					assert.NilError(t, err, "expected the task agent to report the task")
+
+					assertTerminationMessage(t, filepath.Join(scratchDir, "left-to-agent-termination-log"),
+						terminationMessage{
+							Reason:        "custom entrypoint [" + shell(t) + " -c sleep 1; exit 3] exited unexpectedly: exit status 3",
+							Class:         "fatal",
+							Code:          "ENTRYPOINT_FAILED",
+							Outcome:       "left-to-agent",
+							AgentExitCode: ptr(0),
+						})
+				},
+			},
+		},
+		{
+			name:     "error: task agent was OOM killed",
+			unixOnly: true,
+			setup: func(t *testing.T) {
+				override(t, &cgroupDir, filepath.Join(scratchDir, "cgroup"))
+				assert.NilError(t, os.MkdirAll(cgroupDir, 0750))
+				writeFakeCgroup(t, cgroupDir, 2)
+			},
+			config: defaultConfig,
+			env: map[string]string{
+				"SIMULATE_OOM_KILL": filepath.Join(scratchDir, "cgroup"),
+			},
+			wantError: "error while executing task agent: task agent command was killed after the task container " +
+				"exceeded its memory limit (memory limit: 512.0 MiB): signal: killed",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					Code:           "OOM_KILLED",
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("error while executing task agent: task agent command was killed after the task container " +
+						"exceeded its memory limit (memory limit: 512.0 MiB): signal: killed: " +
+						"Check container logs for more details"),
+				},
+			},
+		},
+		{
+			name: "undelivered events are replayed",
+			config: func() Config {
+				c := defaultConfig
+				c.TaskID = "replay"
+				c.StateDir = filepath.Join(scratchDir, "replay-state")
+				writeOutbox(t, c.StateDir, c.TaskID, []outboxEvent{
+					{Key: "delivered-key", Kind: outboxFail, Timestamp: time.Now(), Message: "old", Delivered: true},
+					{Key: "pending-key", Kind: outboxFail, Timestamp: time.Now(), Message: "lost"},
+				})
+				return c
+			}(),
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					TimestampMilli: time.Now().UnixMilli(),
+					Message:        []byte("lost"),
+					IdempotencyKey: "pending-key",
+				},
+			},
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					for _, ev := range readOutbox(t, filepath.Join(scratchDir, "replay-state"), "replay") {
+						assert.Check(t, ev.Delivered, "expected %q to be delivered", ev.Key)
+					}
+				},
+			},
+		},
+		{
+			name: "undelivered unclaim is superseded by a fail event",
+			config: func() Config {
+				c := defaultConfig
+				c.TaskID = "superseded"
+				c.StateDir = filepath.Join(scratchDir, "superseded-state")
+				c.Cmd = []string{shell(t), "-c", fmt.Sprintf("touch %s",
+					filepath.ToSlash(filepath.Join(scratchDir, "superseded-entrypoint")))}
+				writeOutbox(t, c.StateDir, c.TaskID, []outboxEvent{
+					{Key: "unclaim-key", Kind: outboxUnclaim, Timestamp: time.Now()},
+					{Key: "fail-key", Kind: outboxFail, Timestamp: time.Now(), Message: "failed", Delivered: true},
+				})
+				writeState(t, c.StateDir, c.TaskID, attemptState{
+					TaskID: c.TaskID, Attempt: 1, Phase: phaseRunning, EventsSent: []outboxEventKind{outboxFail},
+				})
+				return c
+			}(),
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					_, err := os.Stat(filepath.Join(scratchDir, "superseded-entrypoint"))
+					assert.Check(t, os.IsNotExist(err), "expected the task not to be run again")
+				},
+			},
+		},
+		{
+			name: "previous attempt already finished the task",
+			config: func() Config {
+				c := defaultConfig
+				c.TaskID = "finished"
+				c.StateDir = filepath.Join(scratchDir, "finished-state")
+				c.Cmd = []string{shell(t), "-c", fmt.Sprintf("touch %s",
+					filepath.ToSlash(filepath.Join(scratchDir, "finished-entrypoint")))}
+				writeState(t, c.StateDir, c.TaskID, attemptState{TaskID: c.TaskID, Attempt: 1, Phase: phaseCompleted})
+				return c
+			}(),
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					_, err := os.Stat(filepath.Join(scratchDir, "finished-entrypoint"))
+					assert.Check(t, os.IsNotExist(err), "expected the task not to be run again")
+				},
+			},
+		},
+		{
+			name: "previous attempt restarted before starting the task agent",
+			config: func() Config {
+				c := defaultConfig
+				c.TaskID = "resumed"
+				c.StateDir = filepath.Join(scratchDir, "resumed-state")
+				writeState(t, c.StateDir, c.TaskID, attemptState{TaskID: c.TaskID, Attempt: 1, Phase: phaseWaitingForReadiness})
+				return c
+			}(),
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					state := readState(t, filepath.Join(scratchDir, "resumed-state"), "resumed")
+					assert.Check(t, cmp.Equal(state.Attempt, 2))
+					assert.Check(t, cmp.Equal(state.Phase, phaseCompleted))
+					assert.Check(t, state.AgentPID != 0, "expected the task agent to be started")
+					assert.Check(t, state.AgentStartedAt != nil)
+					assert.Check(t, cmp.DeepEqual(state.AgentExit, &agentExit{ExitCode: 0},
+						cmpopts.IgnoreFields(agentExit{}, "ExitedAt")))
+				},
+			},
+		},
+		{
+			name: "previous attempt's task agent exited successfully",
+			config: func() Config {
+				c := defaultConfig
+				c.TaskID = "exited"
+				c.StateDir = filepath.Join(scratchDir, "exited-state")
+				c.Cmd = []string{shell(t), "-c", fmt.Sprintf("touch %s",
+					filepath.ToSlash(filepath.Join(scratchDir, "exited-entrypoint")))}
+				writeState(t, c.StateDir, c.TaskID, attemptState{
+					TaskID: c.TaskID, Attempt: 1, Phase: phaseRunning, AgentPID: 1234,
+					AgentExit: &agentExit{ExitedAt: time.Now(), ExitCode: 0},
+				})
+				return c
+			}(),
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					_, err := os.Stat(filepath.Join(scratchDir, "exited-entrypoint"))
+					assert.Check(t, os.IsNotExist(err), "expected the task not to be run again")
+				},
+			},
+		},
+		{
+			name: "error: previous attempt's task agent failed before the error was reported",
+			config: func() Config {
+				c := defaultConfig
+				c.TaskID = "agent-failed"
+				c.StateDir = filepath.Join(scratchDir, "agent-failed-state")
+				writeState(t, c.StateDir, c.TaskID, attemptState{
+					TaskID: c.TaskID, Attempt: 1, Phase: phaseRunning, AgentPID: 1234,
+					AgentExit: &agentExit{ExitedAt: time.Now(), ExitCode: -1, Signal: "SIGKILL"},
+				})
+				return c
+			}(),
+			wantError: "the orchestrator was restarted after the task agent (pid 1234) was terminated by SIGKILL " +
+				"in a previous attempt, before the error was reported",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					Code:           "ORCHESTRATOR_RESTARTED",
+					IdempotencyKey: "testkey",
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("the orchestrator was restarted after the task agent (pid 1234) was terminated " +
+						"by SIGKILL in a previous attempt, before the error was reported: " +
+						"Check container logs for more details"),
+				},
+			},
+		},
+		{
+			name: "error: previous attempt started the task agent",
+			config: func() Config {
+				c := defaultConfig
+				c.TaskID = "restarted"
+				c.StateDir = filepath.Join(scratchDir, "restarted-state")
+				writeState(t, c.StateDir, c.TaskID, attemptState{
+					TaskID: c.TaskID, Attempt: 1, Phase: phaseRunning, AgentPID: 1234,
+				})
+				return c
+			}(),
+			wantError: "the orchestrator was restarted after a previous attempt started the task agent (pid 1234), " +
+				"so the task can't be safely run again",
+			wantTaskEvents: []fakerunnerapi.TaskEvent{
+				{
+					Allocation:     defaultConfig.Allocation,
+					Code:           "ORCHESTRATOR_RESTARTED",
+					IdempotencyKey: "testkey",
+					TimestampMilli: time.Now().UnixMilli(),
+					Message: []byte("the orchestrator was restarted after a previous attempt started the task agent " +
+						"(pid 1234), so the task cant be safely run again: Check container logs for more details"),
+				},
+			},
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					state := readState(t, filepath.Join(scratchDir, "restarted-state"), "restarted")
+					assert.Check(t, cmp.Equal(state.Attempt, 2))
+					assert.Check(t, cmp.Equal(state.Phase, phaseCompleted))
+					assert.Check(t, cmp.Equal(state.AgentPID, 1234), "expected the previous attempt to be kept")
+					assert.Check(t, cmp.DeepEqual(state.EventsSent, []outboxEventKind{outboxFail}))
+				},
+			},
+		},
+		{
+			name: "retryable error: unclaim is journaled",
+			config: Config{
+				TaskID:        "journaled",
+				Token:         "journaled-token",
+				TaskAgentPath: "thiswontstart",
+				StateDir:      filepath.Join(scratchDir, "journaled-state"),
 			},
-			wantError: "error while executing task agent: " +
-				"task agent command exited with an unexpected error: exit status 1",
-			wantTaskEvents: []fakerunnerapi.TaskEvent{
+			wantTaskUnclaims: []fakerunnerapi.TaskUnclaim{
 				{
-					Allocation:     defaultConfig.Allocation,
-					TimestampMilli: time.Now().UnixMilli(),
-					Message: []byte("error while executing task agent: " +
-						"task agent command exited with an unexpected error: exit status 1: fatal!!!: " +
-						"Check container logs for more details"),
+					ID:             "journaled",
+					Token:          "journaled-token",
+					IdempotencyKey: "testkey",
+				},
+			},
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					events := readOutbox(t, filepath.Join(scratchDir, "journaled-state"), "journaled")
+					assert.Assert(t, cmp.Len(events, 1))
+					assert.Check(t, cmp.Equal(events[0].Key, "testkey"))
+					assert.Check(t, cmp.Equal(events[0].Kind, outboxUnclaim))
+					assert.Check(t, events[0].Delivered)
 				},
 			},
 		},
 		{
 			name: "retryable error: task agent failed to start",
 			config: Config{
-				TaskID:        "retry",
-				Token:         "retry-token",
-				TaskAgentPath: "thiswontstart",
+				TaskID:                 "retry",
+				Token:                  "retry-token",
+				TaskAgentPath:          "thiswontstart",
+				TerminationMessagePath: filepath.Join(scratchDir, "retry-termination-log"),
 			},
 			wantError: "",
 			wantTaskUnclaims: []fakerunnerapi.TaskUnclaim{
@@ -200,18 +814,29 @@ func TestOrchestrator(t *testing.T) {
 					Token: "retry-token",
 				},
 			},
+			extraChecks: []func(t *testing.T){
+				func(t *testing.T) {
+					assertTerminationMessage(t, filepath.Join(scratchDir, "retry-termination-log"), terminationMessage{
+						Reason: "error while executing task agent: failed to start task agent command: " +
+							`exec: "thiswontstart": executable file not found in ` + pathEnv(t),
+						Class:   "retryable",
+						Code:    "AGENT_START_FAILED",
+						Outcome: "retried",
+						TaskID:  "retry",
+					})
+				},
+			},
 		},
 		{
 			name: "retryable error: service containers didn't become ready in time",
+			setup: func(t *testing.T) {
+				override(t, &waitForReadinessTimeout, 1*time.Millisecond)
+			},
 			config: func() Config {
-				waitForReadinessTimeout = 1 * time.Millisecond
 				c := defaultConfig
 				c.ReadinessFilePath = "does-not-exist"
 				return c
 			}(),
-			cleanup: func() {
-				waitForReadinessTimeout = 10 * time.Minute
-			},
 			wantError: "error waiting for service containers to become ready: context deadline exceeded",
 			wantTaskUnclaims: []fakerunnerapi.TaskUnclaim{
 				{
@@ -221,6 +846,7 @@ func TestOrchestrator(t *testing.T) {
 			wantTaskEvents: []fakerunnerapi.TaskEvent{
 				{
 					Allocation:     defaultConfig.Allocation,
+					Code:           "READINESS_TIMEOUT",
 					TimestampMilli: time.Now().UnixMilli(),
 					Message: []byte("error waiting for service containers to become ready: context deadline exceeded: " +
 						"Check container logs for more details"),
@@ -269,6 +895,7 @@ func TestOrchestrator(t *testing.T) {
 			},
 			wantTaskEvents: []fakerunnerapi.TaskEvent{
 				{
+					Code:           "AGENT_START_FAILED",
 					TimestampMilli: time.Now().UnixMilli(),
 					Message: []byte("error while executing task agent: " +
 						"failed to start task agent command: " +
@@ -281,12 +908,16 @@ func TestOrchestrator(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			t.Setenv("BE_TASK_AGENT", "true")
+			if tt.setup != nil {
+				tt.setup(t)
+			}
 
-			if tt.cleanup != nil {
-				t.Cleanup(tt.cleanup)
+			if tt.unixOnly && runtime.GOOS == "windows" {
+				t.Skip("signals are unsupported on windows")
 			}
 
+			t.Setenv("BE_TASK_AGENT", "true")
+
 			for k, v := range tt.env {
 				t.Setenv(k, v)
 			}
@@ -326,6 +957,18 @@ func TestOrchestrator(t *testing.T) {
 			assert.Check(t, cmp.DeepEqual(runnerAPI.TaskUnclaims(), tt.wantTaskUnclaims))
 			assert.Check(t, cmp.DeepEqual(runnerAPI.TaskEvents(), tt.wantTaskEvents, fakerunnerapi.CmpTaskEvent))
 
+			if tt.wantLifecycle != nil {
+				var events []string
+				for i, e := range runnerAPI.LifecycleEvents() {
+					events = append(events, e.Event)
+					if i > 0 {
+						assert.Check(t, e.TimestampMilli >= runnerAPI.LifecycleEvents()[i-1].TimestampMilli,
+							"expected lifecycle events in order")
+					}
+				}
+				assert.Check(t, cmp.DeepEqual(events, tt.wantLifecycle))
+			}
+
 			for _, check := range tt.extraChecks {
 				check(t)
 			}
@@ -333,6 +976,40 @@ func TestOrchestrator(t *testing.T) {
 	}
 }
 
+func writeOutbox(t *testing.T, dir, taskID string, events []outboxEvent) {
+	t.Helper()
+
+	ob, err := openOutbox(dir, taskID)
+	assert.NilError(t, err)
+	ob.events = events
+	assert.NilError(t, ob.save())
+}
+
+func writeState(t *testing.T, dir, taskID string, state attemptState) {
+	t.Helper()
+
+	f, _, err := openStateFile(dir, taskID)
+	assert.NilError(t, err)
+	assert.NilError(t, f.update(func(s *attemptState) { *s = state }))
+}
+
+func readState(t *testing.T, dir, taskID string) attemptState {
+	t.Helper()
+
+	f, existed, err := openStateFile(dir, taskID)
+	assert.NilError(t, err)
+	assert.Check(t, existed)
+	return f.load()
+}
+
+func readOutbox(t *testing.T, dir, taskID string) []outboxEvent {
+	t.Helper()
+
+	ob, err := openOutbox(dir, taskID)
+	assert.NilError(t, err)
+	return ob.events
+}
+
 func TestOrchestrator_waitForReadiness(t *testing.T) {
 	t.Run("readiness file already present", func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(testcontext.Background(), 1*time.Second)
@@ -381,6 +1058,486 @@ func TestOrchestrator_waitForReadiness(t *testing.T) {
 	})
 }
 
+func TestOrchestrator_retryAction(t *testing.T) {
+	kindErr := func(kind taskerrors.Kind) error {
+		return fmt.Errorf("wrapped: %w", taskerrors.WithKind(kind, fmt.Errorf("%s", kind)))
+	}
+	retryableKindErr := func(kind taskerrors.Kind) error {
+		return fmt.Errorf("wrapped: %w", taskerrors.WithKind(kind, taskerrors.RetryableErrorf("%s", kind)))
+	}
+
+	tests := []struct {
+		name         string
+		config       Config
+		agentStarted bool
+		err          error
+		want         RetryAction
+	}{
+		{
+			name: "unclassified error",
+			err:  fmt.Errorf("fatal"),
+			want: RetryActionInfraFail,
+		},
+		{
+			name: "unclassified retryable error",
+			err:  taskerrors.RetryableErrorf("try again"),
+			want: RetryActionRetry,
+		},
+		{
+			name:   "unclassified error with unsafe retries",
+			config: Config{EnableUnsafeRetries: true},
+			err:    fmt.Errorf("fatal"),
+			want:   RetryActionRetry,
+		},
+		{
+			name: "readiness timeout by default",
+			err:  retryableKindErr(taskerrors.KindReadinessTimeout),
+			want: RetryActionRetry,
+		},
+		{
+			name:   "readiness timeout infra-failed",
+			config: Config{RetryPolicy: RetryPolicy{taskerrors.KindReadinessTimeout: RetryActionInfraFail}},
+			err:    retryableKindErr(taskerrors.KindReadinessTimeout),
+			want:   RetryActionInfraFail,
+		},
+		{
+			name: "agent failed to start by default",
+			err:  retryableKindErr(taskerrors.KindAgentStartFailed),
+			want: RetryActionRetry,
+		},
+		{
+			name:   "agent failed to start infra-failed",
+			config: Config{RetryPolicy: RetryPolicy{taskerrors.KindAgentStartFailed: RetryActionInfraFail}},
+			err:    retryableKindErr(taskerrors.KindAgentStartFailed),
+			want:   RetryActionInfraFail,
+		},
+		{
+			name: "agent signaled by default",
+			err:  kindErr(taskerrors.KindAgentSignaled),
+			want: RetryActionInfraFail,
+		},
+		{
+			name:   "agent signaled retried",
+			config: Config{RetryPolicy: RetryPolicy{taskerrors.KindAgentSignaled: RetryActionRetry}},
+			err:    kindErr(taskerrors.KindAgentSignaled),
+			want:   RetryActionRetry,
+		},
+		{
+			name: "pod evicted by default",
+			err:  kindErr(taskerrors.KindPodEvicted),
+			want: RetryActionInfraFail,
+		},
+		{
+			name:   "pod evicted retried",
+			config: Config{RetryPolicy: RetryPolicy{taskerrors.KindPodEvicted: RetryActionRetry}},
+			err:    kindErr(taskerrors.KindPodEvicted),
+			want:   RetryActionRetry,
+		},
+		{
+			name:         "pod evicted left to the agent",
+			config:       Config{RetryPolicy: RetryPolicy{taskerrors.KindPodEvicted: RetryActionLetAgentReport}},
+			agentStarted: true,
+			err:          kindErr(taskerrors.KindPodEvicted),
+			want:         RetryActionLetAgentReport,
+		},
+		{
+			name:   "entrypoint failure infra-failed if the agent never started",
+			config: Config{RetryPolicy: RetryPolicy{taskerrors.KindEntrypointFailed: RetryActionLetAgentReport}},
+			err:    kindErr(taskerrors.KindEntrypointFailed),
+			want:   RetryActionInfraFail,
+		},
+		{
+			name: "oom by default",
+			err:  kindErr(taskerrors.KindOOM),
+			want: RetryActionInfraFail,
+		},
+		{
+			name:   "oom retried",
+			config: Config{RetryPolicy: RetryPolicy{taskerrors.KindOOM: RetryActionRetry}},
+			err:    kindErr(taskerrors.KindOOM),
+			want:   RetryActionRetry,
+		},
+		{
+			name:   "oom infra-failed despite unsafe retries",
+			config: Config{EnableUnsafeRetries: true, RetryPolicy: RetryPolicy{taskerrors.KindOOM: RetryActionInfraFail}},
+			err:    kindErr(taskerrors.KindOOM),
+			want:   RetryActionInfraFail,
+		},
+		{
+			name:   "policy for another kind",
+			config: Config{RetryPolicy: RetryPolicy{taskerrors.KindPodEvicted: RetryActionRetry}},
+			err:    kindErr(taskerrors.KindOOM),
+			want:   RetryActionInfraFail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Orchestrator{config: tt.config}
+			if tt.agentStarted {
+				o.agentStartedAt.Store(time.Now())
+			}
+			assert.Check(t, cmp.Equal(o.retryAction(tt.err), tt.want))
+		})
+	}
+}
+
+func TestOrchestrator_interruption(t *testing.T) {
+	tests := []struct {
+		name               string
+		maxRunTime         time.Duration
+		maxRunTimeExceeded bool
+		signal             os.Signal
+		agentStarted       time.Duration
+
+		wantCause  interruptCause
+		wantSignal syscall.Signal
+		wantError  string
+		wantKind   taskerrors.Kind
+	}{
+		{
+			name:         "termination signal",
+			signal:       syscall.SIGTERM,
+			agentStarted: time.Minute,
+			wantCause:    interruptSignal,
+			wantSignal:   syscall.SIGTERM,
+			wantError: "task agent process is still running after the orchestrator received " +
+				cmd.SignalName(syscall.SIGTERM) + ", which means the Pod is being evicted or deleted",
+			wantKind: taskerrors.KindPodEvicted,
+		},
+		{
+			name:               "maximum run time exceeded",
+			maxRunTime:         time.Minute,
+			maxRunTimeExceeded: true,
+			agentStarted:       2 * time.Minute,
+			wantCause:          interruptMaxRunTime,
+			wantError:          "task agent process is still running after exceeding the maximum run time of 1m0s",
+			wantKind:           taskerrors.KindMaxRunTime,
+		},
+		{
+			name:         "internal cancellation isn't guessed to be the maximum run time",
+			maxRunTime:   time.Minute,
+			agentStarted: 2 * time.Minute,
+			wantCause:    interruptInternal,
+			wantError: "task agent process is still running after the orchestrator was stopped " +
+				"before the task completed: context canceled",
+			wantKind: taskerrors.KindInterrupted,
+		},
+		{
+			name:         "termination signal within the maximum run time",
+			maxRunTime:   time.Hour,
+			signal:       syscall.SIGTERM,
+			agentStarted: time.Minute,
+			wantCause:    interruptSignal,
+			wantSignal:   syscall.SIGTERM,
+			wantKind:     taskerrors.KindPodEvicted,
+		},
+		{
+			name:       "internal cancellation before the task agent started",
+			maxRunTime: time.Hour,
+			wantCause:  interruptInternal,
+			wantError: "task agent process is still running after the orchestrator was stopped " +
+				"before the task completed: context canceled",
+			wantKind: taskerrors.KindInterrupted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(testcontext.Background())
+			cancel()
+
+			o := Orchestrator{signals: make(chan os.Signal, 1)}
+			o.config.MaxRunTime = tt.maxRunTime
+			o.maxRunTimeExceeded.Store(tt.maxRunTimeExceeded)
+			if tt.signal != nil {
+				o.signals <- tt.signal
+			}
+			if tt.agentStarted != 0 {
+				o.agentStartedAt.Store(time.Now().Add(-tt.agentStarted))
+			}
+
+			in := o.interruption(ctx)
+			assert.Check(t, cmp.Equal(in.cause, tt.wantCause))
+			assert.Check(t, cmp.Equal(in.signal, tt.wantSignal))
+			assert.Check(t, cmp.Equal(in.agentStarted, tt.agentStarted != 0))
+			assert.Check(t, in.sinceAgentStart >= tt.agentStarted)
+
+			err := in.stillRunningError(tt.maxRunTime)
+			assert.Check(t, cmp.ErrorContains(err, tt.wantError))
+			kind, _ := taskerrors.KindOf(err)
+			assert.Check(t, cmp.Equal(kind, tt.wantKind))
+		})
+	}
+}
+
+func TestOrchestrator_reportingTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		deadline time.Duration
+		want     time.Duration
+	}{
+		{
+			name: "not interrupted",
+			want: maxReportingTimeout,
+		},
+		{
+			name:     "remaining grace period",
+			deadline: 20 * time.Second,
+			want:     20 * time.Second,
+		},
+		{
+			name:     "grace period over",
+			deadline: -time.Second,
+			want:     minReportingTimeout,
+		},
+		{
+			name:     "long grace period",
+			deadline: time.Hour,
+			want:     maxReportingTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Orchestrator{}
+			if tt.deadline != 0 {
+				o.terminationDeadline.Store(time.Now().Add(tt.deadline))
+			}
+
+			got := o.reportingTimeout()
+			assert.Check(t, got <= tt.want && got > tt.want-time.Second, "got %s, want %s", got, tt.want)
+		})
+	}
+}
+
+func TestOrchestrator_handleErrors(t *testing.T) {
+	t.Run("fail event is sent after the unclaim used up its budget", func(t *testing.T) {
+		ctx := testcontext.Background()
+
+		var mu sync.Mutex
+		unclaims, fails := 0, 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch r.URL.Path {
+			case "/api/v3/runner/unclaim":
+				unclaims++
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case "/api/v2/task/event/fail":
+				fails++
+				w.WriteHeader(http.StatusOK)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		o := NewOrchestrator(Config{TaskID: "id", Token: "testtoken", Allocation: "testalloc"},
+			runner.NewClient(runner.ClientConfig{BaseURL: server.URL, AuthToken: "testtoken"}), 0)
+		// The termination grace period is already over, so there's only the minimum time left to report the error
+		o.terminationDeadline.Store(time.Now())
+
+		err := o.handleErrors(ctx, taskerrors.RetryableErrorf("flaky"))
+		assert.Check(t, cmp.ErrorContains(err, "failed to retry task"))
+		assert.Check(t, errors.As(err, &taskerrors.HandledError{}), "expected the task to be failed")
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Check(t, unclaims > 1, "expected the unclaim to be retried")
+		assert.Check(t, cmp.Equal(fails, 1))
+	})
+}
+
+func TestOrchestrator_waitForContainers(t *testing.T) {
+	t.Run("all containers ready", func(t *testing.T) {
+		o := Orchestrator{}
+		o.config.ReadinessDir = t.TempDir()
+		o.config.ReadinessContainers = []string{"redis", "postgres"}
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			assert.Check(t, readiness.Signal(o.config.ReadinessDir, "postgres"))
+			assert.Check(t, readiness.Signal(o.config.ReadinessDir, "redis"))
+		}()
+
+		err := o.waitForContainers(testcontext.Background())
+		assert.NilError(t, err)
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		originalTimeout := waitForReadinessTimeout
+		waitForReadinessTimeout = 500 * time.Millisecond
+		t.Cleanup(func() { waitForReadinessTimeout = originalTimeout })
+
+		o := Orchestrator{}
+		o.config.ReadinessDir = t.TempDir()
+		o.config.ReadinessContainers = []string{"redis", "postgres", "mysql"}
+		assert.NilError(t, readiness.Signal(o.config.ReadinessDir, "postgres"))
+
+		err := o.waitForContainers(testcontext.Background())
+		assert.Check(t, cmp.Error(err, "containers never became ready: redis, mysql: context deadline exceeded"))
+	})
+}
+
+func TestOrchestrator_waitForReadinessConditions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	closedLn, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	closedAddr := closedLn.Addr().String()
+	assert.NilError(t, closedLn.Close())
+
+	override(t, &readinessCheckTimeout, 100*time.Millisecond)
+
+	var hung atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/hangs-once" && !hung.Swap(true):
+			<-r.Context().Done()
+		case r.URL.Path == "/healthz", r.URL.Path == "/hangs-once":
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	readyFile := filepath.Join(t.TempDir(), "ready")
+	created := make(chan struct{})
+	go func() {
+		defer close(created)
+		time.Sleep(200 * time.Millisecond)
+		f, err := os.Create(readyFile) //nolint:gosec // this is a test
+		assert.Check(t, err)
+		assert.Check(t, f.Close())
+	}()
+	// Don't let the test finish before the file is created, even if the case waiting for it is skipped
+	t.Cleanup(func() { <-created })
+
+	const timeout, interval = 2 * time.Second, 10 * time.Millisecond
+	tests := []struct {
+		name       string
+		conditions []ReadinessCondition
+		wantError  string
+	}{
+		{
+			name: "all conditions met",
+			conditions: []ReadinessCondition{
+				{File: readyFile, Timeout: timeout, Interval: interval},
+				{TCP: ln.Addr().String(), Timeout: timeout, Interval: interval},
+				{HTTP: server.URL + "/healthz", Timeout: timeout, Interval: interval},
+				{Exec: []string{shell(t), "-c", "exit 0"}, Timeout: timeout, Interval: interval},
+			},
+		},
+		{
+			name: "http check that hangs is retried",
+			conditions: []ReadinessCondition{
+				{HTTP: server.URL + "/hangs-once", Timeout: timeout, Interval: interval},
+			},
+		},
+		{
+			name: "tcp port not accepting connections",
+			conditions: []ReadinessCondition{
+				{TCP: ln.Addr().String(), Timeout: timeout, Interval: interval},
+				{TCP: closedAddr, Timeout: 100 * time.Millisecond, Interval: interval},
+			},
+			wantError: `readiness condition "tcp ` + closedAddr + `" was not met: context deadline exceeded`,
+		},
+		{
+			name: "http endpoint not healthy",
+			conditions: []ReadinessCondition{
+				{Name: "api", HTTP: server.URL + "/unhealthy", Timeout: 100 * time.Millisecond, Interval: interval},
+			},
+			wantError: `readiness condition "api" was not met: context deadline exceeded` + "\n" +
+				"unexpected status: 503 Service Unavailable",
+		},
+		{
+			name: "command failing",
+			conditions: []ReadinessCondition{
+				{Exec: []string{shell(t), "-c", "exit 1"}, Timeout: 100 * time.Millisecond, Interval: interval},
+			},
+			wantError: "was not met: context deadline exceeded\nexit status 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Orchestrator{}
+			o.config.ReadinessConditions = tt.conditions
+
+			err := o.waitForReadinessConditions(testcontext.Background())
+			if tt.wantError == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.Check(t, cmp.ErrorContains(err, tt.wantError))
+			}
+		})
+	}
+}
+
+func TestOrchestrator_startBackgroundProcesses(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the process is checked with a signal, which is unsupported on windows")
+	}
+
+	t.Run("started processes are stopped if one fails", func(t *testing.T) {
+		pidFile := filepath.Join(t.TempDir(), "proxy.pid")
+
+		o := Orchestrator{}
+		o.config.BackgroundProcesses = []BackgroundProcess{
+			{
+				Name: "proxy",
+				Cmd:  []string{shell(t), "-c", fmt.Sprintf("echo $$ > %s; exec sleep 30", pidFile)},
+			},
+			{
+				Name:         "broken",
+				Cmd:          []string{shell(t), "-c", "sleep 0.5; exit 2"},
+				ReadinessCmd: []string{shell(t), "-c", "exit 1"},
+			},
+		}
+
+		err := o.startBackgroundProcesses(testcontext.Background())
+		assert.Check(t, cmp.ErrorContains(err, "error starting background process \"broken\""))
+		assert.Check(t, cmp.Len(o.background, 0))
+
+		b, err := os.ReadFile(pidFile) //nolint:gosec // this is a test
+		assert.NilError(t, err)
+		pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		assert.NilError(t, err)
+
+		p, err := os.FindProcess(pid)
+		assert.NilError(t, err)
+		assert.Check(t, cmp.ErrorIs(p.Signal(syscall.Signal(0)), os.ErrProcessDone),
+			"expected the proxy to be stopped")
+	})
+}
+
+func assertTerminationMessage(t *testing.T, path string, want terminationMessage) {
+	t.Helper()
+
+	b, err := os.ReadFile(path) //nolint:gosec // this is a test
+	assert.NilError(t, err)
+
+	var got terminationMessage
+	assert.NilError(t, json.Unmarshal(b, &got))
+	assert.Check(t, cmp.DeepEqual(got, want))
+}
+
+func writeFakeCgroup(t *testing.T, dir string, oomKills int) {
+	t.Helper()
+
+	events := fmt.Sprintf("low 0\nhigh 0\nmax 12\noom %d\noom_kill %d\n", oomKills, oomKills)
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "memory.events"), []byte(events), 0600))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "memory.max"), []byte("536870912\n"), 0600))
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
 func beFakeTaskAgent(t *testing.T) {
 	t.Helper()
 
@@ -400,11 +1557,42 @@ func beFakeTaskAgent(t *testing.T) {
 		time.Sleep(30 * time.Second)
 	}
 
+	if reported := os.Getenv("SIMULATE_REPORTING"); reported != "" {
+		// Finish the task after the entrypoint has crashed, then report it
+		time.Sleep(2 * time.Second)
+		assert.NilError(t, os.WriteFile(reported, nil, 0600))
+	}
+
+	if flushed := os.Getenv("SIMULATE_GRACEFUL_SHUTDOWN"); flushed != "" {
+		// Take longer to shut down than the process reap timeout, to check the orchestrator waits
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM)
+		select {
+		case <-sigs:
+			time.Sleep(time.Second)
+			assert.NilError(t, os.WriteFile(flushed, nil, 0600))
+		case <-time.After(30 * time.Second):
+		}
+	}
+
 	if os.Getenv("SIMULATE_FATAL_ERROR") == "true" {
 		_, _ = os.Stderr.WriteString("fatal!!!")
 		os.Exit(1)
 	}
 
+	if dir := os.Getenv("SIMULATE_OOM_KILL"); dir != "" {
+		writeFakeCgroup(t, dir, 3)
+		p, err := os.FindProcess(os.Getpid())
+		assert.NilError(t, err)
+		assert.NilError(t, p.Kill())
+	}
+
+	if os.Getenv("SIMULATE_KILLED") == "true" {
+		p, err := os.FindProcess(os.Getpid())
+		assert.NilError(t, err)
+		assert.NilError(t, p.Kill())
+	}
+
 	if pidfile := os.Getenv("SIMULATE_A_ZOMBIE_PROCESS"); pidfile != "" {
 		pidCmd := "echo $$ >"
 		if runtime.GOOS == "windows" {
@@ -419,6 +1607,15 @@ func beFakeTaskAgent(t *testing.T) {
 	os.Exit(0)
 }
 
+// override sets a package variable for the duration of a test
+func override[T any](t *testing.T, v *T, value T) {
+	t.Helper()
+
+	original := *v
+	*v = value
+	t.Cleanup(func() { *v = original })
+}
+
 func shell(t *testing.T) string {
 	t.Helper()
 
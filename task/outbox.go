@@ -0,0 +1,218 @@
+package task
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/circleci/ex/o11y"
+	"github.com/goccy/go-json"
+
+	"github.com/circleci/runner-init/clients/runner"
+	"github.com/circleci/runner-init/task/taskerrors"
+)
+
+// This can be overridden in tests
+var newIdempotencyKey = rand.Text
+
+type outboxEventKind string
+
+const (
+	outboxUnclaim outboxEventKind = "unclaim"
+	outboxFail    outboxEventKind = "fail"
+)
+
+// outboxEvent is a runner API event that is journaled before it is sent,
+// so it can be replayed if the orchestrator is killed before it is delivered
+type outboxEvent struct {
+	// Key is sent with the event, so the runner API can dedupe replays
+	Key       string          `json:"key"`
+	Kind      outboxEventKind `json:"kind"`
+	Timestamp time.Time       `json:"timestamp"`
+	Code      taskerrors.Code `json:"code,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	Delivered bool            `json:"delivered"`
+}
+
+// outbox is a journal of the runner API events for a task, kept in the state directory.
+// The state directory should be on a volume that outlives the orchestrator's container, such as an emptyDir.
+// The task token isn't journaled, since it is in the config of the next attempt anyway.
+// A nil outbox is a no-op, so events are sent without being journaled or given an idempotency key.
+type outbox struct {
+	path   string
+	events []outboxEvent
+	mu     sync.Mutex
+}
+
+func openOutbox(dir, taskID string) (*outbox, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	ob := &outbox{path: filepath.Join(dir, "outbox-"+taskID+".json")}
+
+	b, err := os.ReadFile(ob.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return ob, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read outbox journal: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &ob.events); err != nil {
+		return nil, fmt.Errorf("failed to parse outbox journal: %w", err)
+	}
+
+	return ob, nil
+}
+
+func (ob *outbox) newEvent(kind outboxEventKind, message string) outboxEvent {
+	ev := outboxEvent{
+		Kind:      kind,
+		Timestamp: time.Now(),
+		Message:   message,
+	}
+	if ob != nil {
+		ev.Key = newIdempotencyKey()
+	}
+	return ev
+}
+
+// record journals the event as pending, unless it already is because it's being replayed
+func (ob *outbox) record(ev outboxEvent) error {
+	if ob == nil {
+		return nil
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	for _, recorded := range ob.events {
+		if recorded.Key == ev.Key {
+			return nil
+		}
+	}
+	ob.events = append(ob.events, ev)
+	return ob.save()
+}
+
+func (ob *outbox) markDelivered(key string) error {
+	if ob == nil {
+		return nil
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	for i := range ob.events {
+		if ob.events[i].Key == key {
+			ob.events[i].Delivered = true
+		}
+	}
+	return ob.save()
+}
+
+// pending is the undelivered events. An unclaim is superseded by any later fail event, since the task was failed
+// after it couldn't be retried, and replaying the unclaim would put a failed task back in the queue.
+func (ob *outbox) pending() (events []outboxEvent) {
+	if ob == nil {
+		return nil
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	for i, ev := range ob.events {
+		if ev.Delivered {
+			continue
+		}
+		if ev.Kind == outboxUnclaim && slices.ContainsFunc(ob.events[i+1:], func(later outboxEvent) bool {
+			return later.Kind == outboxFail
+		}) {
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// save atomically replaces the journal, so it's never left partially written if the orchestrator is killed
+func (ob *outbox) save() error {
+	b, err := json.Marshal(ob.events)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomically(ob.path, b); err != nil {
+		return fmt.Errorf("failed to write outbox journal: %w", err)
+	}
+	return nil
+}
+
+// sendEvent journals the event before sending it to the runner API, and marks it delivered afterward.
+// An event the runner API rejected is marked delivered too, since replaying it won't succeed.
+// Failing to journal the event doesn't stop it being sent.
+func (o *Orchestrator) sendEvent(ctx context.Context, ev outboxEvent) error {
+	if err := o.outbox.record(ev); err != nil {
+		o11y.LogError(ctx, "failed to journal runner API event", err, o11y.Field("kind", ev.Kind))
+	}
+
+	err := o.deliverEvent(ctx, ev)
+	if err == nil || runner.IsRejected(err) {
+		if err := o.outbox.markDelivered(ev.Key); err != nil {
+			o11y.LogError(ctx, "failed to mark runner API event delivered", err, o11y.Field("kind", ev.Kind))
+		}
+		o.recordState(ctx, func(s *attemptState) {
+			s.EventsSent = append(s.EventsSent, ev.Kind)
+		})
+	}
+
+	return err
+}
+
+func (o *Orchestrator) deliverEvent(ctx context.Context, ev outboxEvent) error {
+	c := o.config
+
+	switch ev.Kind {
+	case outboxUnclaim:
+		return o.runnerClient.UnclaimTask(ctx, c.TaskID, c.Token, ev.Key)
+	case outboxFail:
+		return o.runnerClient.FailTask(ctx, ev.Timestamp, c.Allocation, string(ev.Code), ev.Message, ev.Key)
+	default:
+		return fmt.Errorf("unknown runner API event kind %q", ev.Kind)
+	}
+}
+
+// replayOutbox resends any events a previous run of the orchestrator for the task journaled but didn't deliver
+func (o *Orchestrator) replayOutbox(ctx context.Context) {
+	pending := o.outbox.pending()
+	if len(pending) == 0 {
+		return
+	}
+
+	ctx, span := o11y.StartSpan(ctx, "orchestrator: replay-outbox")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, maxReportingTimeout)
+	defer cancel()
+
+	span.AddField("count", len(pending))
+
+	replayed := 0
+	for _, ev := range pending {
+		if err := o.sendEvent(ctx, ev); err != nil {
+			o11y.LogError(ctx, "failed to replay runner API event", err,
+				o11y.Field("kind", ev.Kind), o11y.Field("key", ev.Key))
+			continue
+		}
+		replayed++
+	}
+	span.AddField("replayed", replayed)
+}
@@ -0,0 +1,118 @@
+package readiness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Readiness markers are files on a volume shared between the containers of a task Pod,
+// so service containers can signal they're ready without relying on a shell.
+
+// This can be overridden in tests
+var pollInterval = 250 * time.Millisecond
+
+// Signal atomically creates the named readiness marker in the directory. It is written to a temporary file first,
+// so a waiter never sees a partially created marker.
+func Signal(dir, name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("failed to create readiness directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create readiness marker: %w", err)
+	}
+	tmpPath := f.Name()
+
+	if err := errors.Join(f.Sync(), f.Close()); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to create readiness marker: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(dir, name)); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to create readiness marker: %w", err)
+	}
+
+	return nil
+}
+
+// NotReadyError is returned if waiting is cancelled before all the readiness markers exist
+type NotReadyError struct {
+	Missing []string
+	err     error
+}
+
+func (e NotReadyError) Error() string {
+	return fmt.Sprintf("%v: still waiting for %s", e.err, strings.Join(e.Missing, ", "))
+}
+
+func (e NotReadyError) Unwrap() error {
+	return e.err
+}
+
+// Wait waits until all the named readiness markers exist in the directory, calling onReady (if set) as each appears
+func Wait(ctx context.Context, dir string, names []string, onReady func(name string)) error {
+	for _, name := range names {
+		if err := checkName(name); err != nil {
+			return err
+		}
+	}
+
+	pending := names
+	for {
+		missing, err := Missing(dir, pending...)
+		if err != nil {
+			return err
+		}
+
+		if onReady != nil {
+			for _, name := range pending {
+				if !slices.Contains(missing, name) {
+					onReady(name)
+				}
+			}
+		}
+
+		pending = missing
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return NotReadyError{Missing: pending, err: ctx.Err()}
+		}
+	}
+}
+
+// Missing returns the named readiness markers that don't exist yet in the directory
+func Missing(dir string, names ...string) (missing []string, err error) {
+	for _, name := range names {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, name)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return fmt.Errorf("invalid readiness marker name %q", name)
+	}
+	return nil
+}
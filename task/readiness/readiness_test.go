@@ -0,0 +1,70 @@
+package readiness
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circleci/ex/testing/testcontext"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestSignal(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "status")
+
+	assert.NilError(t, Signal(dir, "redis"))
+	// Signalling again is harmless, such as when a service container restarts
+	assert.NilError(t, Signal(dir, "redis"))
+
+	entries, err := os.ReadDir(dir)
+	assert.NilError(t, err)
+	assert.Assert(t, cmp.Len(entries, 1), "expected no temporary files to be left behind")
+	assert.Check(t, cmp.Equal(entries[0].Name(), "redis"))
+
+	err = Signal(dir, "../escape")
+	assert.Check(t, cmp.ErrorContains(err, `invalid readiness marker name "../escape"`))
+}
+
+func TestWait(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { pollInterval = 250 * time.Millisecond })
+
+	t.Run("markers signalled later", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx, cancel := context.WithTimeout(testcontext.Background(), 2*time.Second)
+		defer cancel()
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			assert.Check(t, Signal(dir, "redis"))
+			time.Sleep(100 * time.Millisecond)
+			assert.Check(t, Signal(dir, "postgres"))
+		}()
+
+		var ready []string
+		assert.NilError(t, Wait(ctx, dir, []string{"redis", "postgres"}, func(name string) {
+			ready = append(ready, name)
+		}))
+		assert.Check(t, cmp.DeepEqual(ready, []string{"redis", "postgres"}))
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.NilError(t, Signal(dir, "redis"))
+
+		ctx, cancel := context.WithTimeout(testcontext.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := Wait(ctx, dir, []string{"redis", "postgres", "mysql"}, nil)
+		assert.Check(t, cmp.ErrorContains(err, "context deadline exceeded: still waiting for postgres, mysql"))
+		assert.Check(t, cmp.ErrorIs(err, context.DeadlineExceeded))
+
+		var notReady NotReadyError
+		assert.Assert(t, errors.As(err, &notReady))
+		assert.Check(t, cmp.DeepEqual(notReady.Missing, []string{"postgres", "mysql"}))
+	})
+}
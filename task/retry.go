@@ -0,0 +1,76 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/circleci/runner-init/task/taskerrors"
+)
+
+// RetryAction is how the orchestrator handles a task error
+type RetryAction string
+
+const (
+	// RetryActionRetry unclaims the task, so it is retried, and infra-fails it if that isn't possible
+	RetryActionRetry RetryAction = "retry"
+	// RetryActionInfraFail sends a fail event for the task
+	RetryActionInfraFail RetryAction = "infra-fail"
+	// RetryActionLetAgentReport leaves the task agent to report the outcome of the task itself
+	RetryActionLetAgentReport RetryAction = "let-agent-report"
+)
+
+// RetryPolicy maps kinds of task error to how they're handled. Any kind that isn't in the policy is retried if
+// it is retryable or unsafe retries are enabled, and infra-failed otherwise.
+type RetryPolicy map[taskerrors.Kind]RetryAction
+
+// unreportableKinds are errors the task agent can't report itself, since it never ran, ran in a previous attempt,
+// or has already been killed
+var unreportableKinds = []taskerrors.Kind{
+	taskerrors.KindReadinessTimeout, taskerrors.KindAgentStartFailed, taskerrors.KindRestarted,
+	taskerrors.KindAgentSignaled, taskerrors.KindOOM, taskerrors.KindMaxRunTime,
+}
+
+// interruptionKinds are errors where the task agent is only given a chance to report the interruption if it is
+// signalled before it is killed
+var interruptionKinds = []taskerrors.Kind{taskerrors.KindPodEvicted, taskerrors.KindInterrupted}
+
+func (p RetryPolicy) validate(agentSignalled bool) error {
+	for kind, action := range p {
+		if !slices.Contains(taskerrors.Kinds, kind) {
+			return fmt.Errorf("unknown error kind %q in retry policy", kind)
+		}
+
+		switch action {
+		case RetryActionRetry, RetryActionInfraFail:
+		case RetryActionLetAgentReport:
+			if slices.Contains(unreportableKinds, kind) {
+				return fmt.Errorf("retry action %q can't be used for %q errors", action, kind)
+			}
+			if !agentSignalled && slices.Contains(interruptionKinds, kind) {
+				return fmt.Errorf("retry action %q can't be used for %q errors without an agent termination signal",
+					action, kind)
+			}
+		default:
+			return fmt.Errorf("unknown retry action %q for %q errors", action, kind)
+		}
+	}
+	return nil
+}
+
+func (o *Orchestrator) retryAction(err error) RetryAction {
+	if kind, ok := taskerrors.KindOf(err); ok {
+		if action, ok := o.config.RetryPolicy[kind]; ok {
+			// The task agent can't report anything if it never started
+			if action == RetryActionLetAgentReport && o.agentStartedAt.Load() == nil {
+				return RetryActionInfraFail
+			}
+			return action
+		}
+	}
+
+	if errors.As(err, &taskerrors.RetryableError{}) || o.config.EnableUnsafeRetries {
+		return RetryActionRetry
+	}
+	return RetryActionInfraFail
+}
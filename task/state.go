@@ -0,0 +1,200 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/circleci/ex/o11y"
+	"github.com/goccy/go-json"
+
+	"github.com/circleci/runner-init/task/taskerrors"
+)
+
+// phaseCompleted is only recorded in the state file, once the orchestrator has finished with the task
+const phaseCompleted phase = "completed"
+
+// attemptState is the progress of the orchestrator's latest attempt at the task
+type attemptState struct {
+	TaskID         string            `json:"task_id"`
+	Attempt        int               `json:"attempt"`
+	Phase          phase             `json:"phase"`
+	StartedAt      time.Time         `json:"started_at"`
+	AgentPID       int               `json:"agent_pid,omitempty"`
+	AgentStartedAt *time.Time        `json:"agent_started_at,omitempty"`
+	AgentExit      *agentExit        `json:"agent_exit,omitempty"`
+	EventsSent     []outboxEventKind `json:"events_sent,omitempty"`
+}
+
+// agentExit is how the task agent exited, so the orchestrator knows the task finished even if it was restarted
+// before shutting down
+type agentExit struct {
+	ExitedAt time.Time `json:"exited_at"`
+	ExitCode int       `json:"exit_code"`
+	Signal   string    `json:"signal,omitempty"`
+}
+
+func (e agentExit) String() string {
+	if e.Signal != "" {
+		return "was terminated by " + e.Signal
+	}
+	return fmt.Sprintf("exited with code %d", e.ExitCode)
+}
+
+// stateFile records the progress of the task in the state directory, so the orchestrator can tell if its
+// container was restarted part way through the task. A nil state file is a no-op.
+type stateFile struct {
+	path  string
+	state attemptState
+	mu    sync.Mutex
+}
+
+// openStateFile loads the state of any previous attempt at the task
+func openStateFile(dir, taskID string) (f *stateFile, existed bool, err error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, false, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	f = &stateFile{path: filepath.Join(dir, "state-"+taskID+".json")}
+
+	b, err := os.ReadFile(f.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return f, false, nil
+	case err != nil:
+		return nil, false, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &f.state); err != nil {
+		return nil, false, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	return f, true, nil
+}
+
+func (f *stateFile) load() attemptState {
+	if f == nil {
+		return attemptState{}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.state
+}
+
+func (f *stateFile) update(fn func(s *attemptState)) error {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fn(&f.state)
+
+	b, err := json.Marshal(f.state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(f.path, b)
+}
+
+// recordState updates the state file. This is best-effort, since it only guards against container restarts.
+func (o *Orchestrator) recordState(ctx context.Context, fn func(s *attemptState)) {
+	if err := o.state.update(fn); err != nil {
+		o11y.LogError(ctx, "failed to update state file", err)
+	}
+}
+
+// resumeTask opens the outbox and state file in the state directory, replaying any undelivered events,
+// and checks for a previous attempt at the task. It is done if a previous attempt already finished the task,
+// or the task agent exited successfully. It errors if a previous attempt started the task agent, since running it
+// again could run the task twice.
+func (o *Orchestrator) resumeTask(ctx context.Context) (done bool, err error) {
+	ctx, span := o11y.StartSpan(ctx, "orchestrator: resume-task")
+	defer o11y.End(span, &err)
+
+	c := o.config
+
+	state, existed, err := openStateFile(c.StateDir, c.TaskID)
+	if err != nil {
+		// The task can still be run, just not protected from being run twice
+		o11y.LogError(ctx, "failed to open state file", err)
+	} else {
+		o.state = state
+	}
+
+	ob, err := openOutbox(c.StateDir, c.TaskID)
+	if err != nil {
+		// Runner API events can still be sent, just not replayed if the orchestrator is killed
+		o11y.LogError(ctx, "failed to open outbox journal", err)
+	} else {
+		o.outbox = ob
+		o.replayOutbox(ctx)
+	}
+
+	prev := o.state.load()
+	span.AddField("previous_attempt", existed)
+	if existed {
+		span.AddField("previous_phase", prev.Phase)
+		span.AddField("previous_agent_pid", prev.AgentPID)
+		span.AddField("previous_events_sent", prev.EventsSent)
+	}
+
+	switch {
+	case existed && (prev.Phase == phaseCompleted || len(prev.EventsSent) > 0):
+		o11y.Log(ctx, "a previous attempt already finished the task", o11y.Field("attempt", prev.Attempt))
+		return true, nil
+	case existed && prev.AgentExit != nil && prev.AgentExit.ExitCode == 0:
+		o11y.Log(ctx, "the task agent already finished the task in a previous attempt",
+			o11y.Field("attempt", prev.Attempt))
+		return true, nil
+	case existed && prev.AgentExit != nil:
+		err = taskerrors.WithKind(taskerrors.KindRestarted,
+			fmt.Errorf("the orchestrator was restarted after the task agent (pid %d) %s in a previous attempt, "+
+				"before the error was reported", prev.AgentPID, prev.AgentExit))
+	case existed && prev.AgentPID != 0:
+		err = taskerrors.WithKind(taskerrors.KindRestarted,
+			fmt.Errorf("the orchestrator was restarted after a previous attempt started the task agent "+
+				"(pid %d), so the task can't be safely run again", prev.AgentPID))
+	}
+
+	// The previous attempt's progress is kept, so it isn't forgotten if this attempt is restarted too
+	o.recordState(ctx, func(s *attemptState) {
+		s.TaskID = c.TaskID
+		s.Attempt++
+		s.Phase = phaseWaitingForReadiness
+		s.StartedAt = time.Now()
+	})
+
+	return false, err
+}
+
+// writeFileAtomically writes to a temporary file first, so the file is never left partially written
+// if the orchestrator is killed
+func writeFileAtomically(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+
+	_, err = f.Write(b)
+	if err := errors.Join(err, f.Sync(), f.Close()); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/circleci/ex/o11y"
+
+	"github.com/circleci/runner-init/task/taskerrors"
+)
+
+// EntrypointPolicy is what the orchestrator does if the custom entrypoint exits with an error during the task
+type EntrypointPolicy string
+
+const (
+	// EntrypointPolicyIgnore only logs the exit of the entrypoint, which is the default
+	EntrypointPolicyIgnore EntrypointPolicy = "ignore"
+	// EntrypointPolicyFailTask fails the task, for when the entrypoint is a daemon the task depends on
+	EntrypointPolicyFailTask EntrypointPolicy = "fail-task"
+	// EntrypointPolicyRestart restarts the entrypoint with a backoff, failing the task once out of attempts
+	EntrypointPolicyRestart EntrypointPolicy = "restart"
+)
+
+const defaultEntrypointMaxRestarts = 3
+
+var (
+	// These can be overridden in tests
+	entrypointRestartBackoff    = 1 * time.Second
+	entrypointMaxRestartBackoff = 30 * time.Second
+)
+
+func (p EntrypointPolicy) validate() error {
+	switch p {
+	case "", EntrypointPolicyIgnore, EntrypointPolicyFailTask, EntrypointPolicyRestart:
+		return nil
+	default:
+		return fmt.Errorf("unknown entrypoint policy %q", p)
+	}
+}
+
+// superviseEntrypoint watches the custom entrypoint until the task is over, applying the entrypoint policy
+// if it exits with an error. An error is only returned if the task should be failed.
+func (o *Orchestrator) superviseEntrypoint(ctx context.Context) (err error) {
+	ctx, span := o11y.StartSpan(ctx, "orchestrator: supervise-entrypoint")
+	defer o11y.End(span, &err)
+
+	c := o.config
+	policy := c.EntrypointPolicy
+	if policy == "" {
+		policy = EntrypointPolicyIgnore
+	}
+	span.AddField("policy", policy)
+
+	maxRestarts := c.EntrypointMaxRestarts
+	if maxRestarts == 0 {
+		maxRestarts = defaultEntrypointMaxRestarts
+	}
+
+	for restarts := 0; ; restarts++ {
+		waitErr := o.entrypoint.Wait()
+		if ctx.Err() != nil {
+			// The task is over, so the entrypoint was stopped along with it
+			return nil
+		}
+
+		if status, ok := o.entrypoint.ExitStatus(); ok {
+			addExitStatusFields(span, status)
+		}
+
+		if waitErr == nil {
+			o11y.Log(ctx, "custom entrypoint exited", o11y.Field("cmd", c.Cmd))
+			return nil
+		}
+		o11y.LogError(ctx, "custom entrypoint exited with an error", waitErr,
+			o11y.Field("cmd", c.Cmd), o11y.Field("policy", policy), o11y.Field("restarts", restarts))
+
+		switch policy {
+		case EntrypointPolicyFailTask:
+			return taskerrors.WithKind(taskerrors.KindEntrypointFailed,
+				fmt.Errorf("custom entrypoint %s exited unexpectedly: %v", c.Cmd, waitErr))
+		case EntrypointPolicyRestart:
+			if restarts >= maxRestarts {
+				return taskerrors.WithKind(taskerrors.KindEntrypointFailed,
+					fmt.Errorf("custom entrypoint %s exited unexpectedly after %d restarts: %v", c.Cmd, restarts, waitErr))
+			}
+		default:
+			return nil
+		}
+
+		select {
+		case <-time.After(restartBackoff(restarts)):
+		case <-ctx.Done():
+			return nil
+		}
+
+		span.AddField("restarts", restarts+1)
+		if err := o.executeEntrypoint(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func restartBackoff(restarts int) time.Duration {
+	backoff := entrypointRestartBackoff
+	for range restarts {
+		backoff *= 2
+		if backoff >= entrypointMaxRestartBackoff {
+			return entrypointMaxRestartBackoff
+		}
+	}
+	return backoff
+}
@@ -1,6 +1,9 @@
 package taskerrors
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 type RetryableError struct {
 	error
@@ -23,3 +26,102 @@ func (h HandledError) Error() string {
 func NewHandledError(err error) HandledError {
 	return HandledError{err}
 }
+
+// Class is a coarse classification of a task error
+type Class string
+
+const (
+	ClassRetryable Class = "retryable"
+	ClassFatal     Class = "fatal"
+)
+
+func Classify(err error) Class {
+	if errors.As(err, &RetryableError{}) {
+		return ClassRetryable
+	}
+	return ClassFatal
+}
+
+// Kind identifies what went wrong with a task, so how it's handled can be configured
+type Kind string
+
+const (
+	KindReadinessTimeout Kind = "readiness-timeout"
+	KindAgentStartFailed Kind = "agent-start-failed"
+	KindAgentSignaled    Kind = "agent-signaled"
+	KindPodEvicted       Kind = "pod-evicted"
+	KindOOM              Kind = "oom"
+	KindEntrypointFailed Kind = "entrypoint-failed"
+	KindInterrupted      Kind = "interrupted"
+	KindMaxRunTime       Kind = "max-run-time"
+	KindRestarted        Kind = "restarted"
+)
+
+var Kinds = []Kind{
+	KindReadinessTimeout, KindAgentStartFailed, KindAgentSignaled, KindPodEvicted, KindOOM, KindEntrypointFailed,
+	KindInterrupted, KindMaxRunTime, KindRestarted,
+}
+
+// Code is a stable, machine-readable identifier for a kind of task error, so failures can be grouped
+// without matching on messages. Codes must not be changed once they're released.
+type Code string
+
+const (
+	CodeReadinessTimeout Code = "READINESS_TIMEOUT"
+	CodeAgentStartFailed Code = "AGENT_START_FAILED"
+	CodeAgentSignaled    Code = "AGENT_SIGNALLED"
+	CodePodEvicted       Code = "POD_EVICTED"
+	CodeOOMKilled        Code = "OOM_KILLED"
+	CodeEntrypointFailed Code = "ENTRYPOINT_FAILED"
+	CodeInterrupted      Code = "INTERRUPTED"
+	CodeMaxRunTime       Code = "MAX_RUN_TIME_EXCEEDED"
+	CodeRestarted        Code = "ORCHESTRATOR_RESTARTED"
+)
+
+var codes = map[Kind]Code{
+	KindReadinessTimeout: CodeReadinessTimeout,
+	KindAgentStartFailed: CodeAgentStartFailed,
+	KindAgentSignaled:    CodeAgentSignaled,
+	KindPodEvicted:       CodePodEvicted,
+	KindOOM:              CodeOOMKilled,
+	KindEntrypointFailed: CodeEntrypointFailed,
+	KindInterrupted:      CodeInterrupted,
+	KindMaxRunTime:       CodeMaxRunTime,
+	KindRestarted:        CodeRestarted,
+}
+
+func (k Kind) Code() Code {
+	return codes[k]
+}
+
+type KindError struct {
+	kind Kind
+	err  error
+}
+
+func WithKind(kind Kind, err error) KindError {
+	return KindError{kind: kind, err: err}
+}
+
+func (e KindError) Error() string {
+	return e.err.Error()
+}
+
+func (e KindError) Unwrap() error {
+	return e.err
+}
+
+// KindOf returns the kind of the first error in the tree that has one
+func KindOf(err error) (Kind, bool) {
+	var kindErr KindError
+	if errors.As(err, &kindErr) {
+		return kindErr.kind, true
+	}
+	return "", false
+}
+
+// CodeOf returns the code of the first error in the tree that has a kind, or an empty code if none do
+func CodeOf(err error) Code {
+	kind, _ := KindOf(err)
+	return kind.Code()
+}
@@ -23,3 +23,70 @@ func TestNewHandledError(t *testing.T) {
 		assert.Check(t, !errors.As(err, &HandledError{}))
 	})
 }
+
+func TestClassify(t *testing.T) {
+	t.Run("Retryable", func(t *testing.T) {
+		err := fmt.Errorf("wrapped: %w", RetryableErrorf("try again"))
+
+		assert.Check(t, cmp.Equal(Classify(err), ClassRetryable))
+	})
+
+	t.Run("Fatal", func(t *testing.T) {
+		assert.Check(t, cmp.Equal(Classify(fmt.Errorf("fatal")), ClassFatal))
+	})
+}
+
+func TestKindOf(t *testing.T) {
+	t.Run("Has a kind", func(t *testing.T) {
+		err := fmt.Errorf("wrapped: %w", WithKind(KindOOM, fmt.Errorf("out of memory")))
+
+		kind, ok := KindOf(err)
+		assert.Check(t, ok)
+		assert.Check(t, cmp.Equal(kind, KindOOM))
+		assert.Check(t, cmp.ErrorContains(err, "wrapped: out of memory"))
+	})
+
+	t.Run("Retryable with a kind", func(t *testing.T) {
+		err := WithKind(KindAgentStartFailed, RetryableErrorf("failed to start"))
+
+		kind, ok := KindOf(err)
+		assert.Check(t, ok)
+		assert.Check(t, cmp.Equal(kind, KindAgentStartFailed))
+		assert.Check(t, cmp.Equal(Classify(err), ClassRetryable))
+	})
+
+	t.Run("Joined", func(t *testing.T) {
+		err := errors.Join(fmt.Errorf("shutdown"), WithKind(KindPodEvicted, fmt.Errorf("evicted")))
+
+		kind, ok := KindOf(err)
+		assert.Check(t, ok)
+		assert.Check(t, cmp.Equal(kind, KindPodEvicted))
+	})
+
+	t.Run("Has no kind", func(t *testing.T) {
+		_, ok := KindOf(fmt.Errorf("fatal"))
+		assert.Check(t, !ok)
+	})
+}
+
+func TestCodeOf(t *testing.T) {
+	t.Run("Every kind has a code", func(t *testing.T) {
+		seen := map[Code]bool{}
+		for _, kind := range Kinds {
+			code := kind.Code()
+			assert.Check(t, code != "", "expected %q to have a code", kind)
+			assert.Check(t, !seen[code], "expected %q to have a unique code", kind)
+			seen[code] = true
+		}
+	})
+
+	t.Run("Has a code", func(t *testing.T) {
+		err := fmt.Errorf("wrapped: %w", WithKind(KindReadinessTimeout, RetryableErrorf("timed out")))
+
+		assert.Check(t, cmp.Equal(CodeOf(err), CodeReadinessTimeout))
+	})
+
+	t.Run("Has no code", func(t *testing.T) {
+		assert.Check(t, cmp.Equal(CodeOf(fmt.Errorf("fatal")), Code("")))
+	})
+}
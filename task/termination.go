@@ -0,0 +1,83 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/circleci/ex/o11y"
+	"github.com/goccy/go-json"
+
+	"github.com/circleci/runner-init/task/cmd"
+	"github.com/circleci/runner-init/task/taskerrors"
+)
+
+// Kubernetes truncates termination messages to 4096 bytes, so leave room for the other fields
+const maxTerminationReasonLength = 3072
+
+type outcome string
+
+const (
+	outcomeRetried     outcome = "retried"
+	outcomeInfraFailed outcome = "infra-failed"
+	outcomeUnreported  outcome = "unreported"
+	// outcomeLeftToAgent is when the retry policy leaves the task agent to report the error itself
+	outcomeLeftToAgent outcome = "left-to-agent"
+)
+
+// terminationMessage is a concise summary of why the task ended, written to the container's termination message
+// path, so container agent and `kubectl describe` can surface it without scraping logs
+type terminationMessage struct {
+	Reason        string           `json:"reason"`
+	Class         taskerrors.Class `json:"class"`
+	Code          taskerrors.Code  `json:"code,omitempty"`
+	Outcome       outcome          `json:"outcome"`
+	TaskID        string           `json:"task_id,omitempty"`
+	AgentExitCode *int             `json:"agent_exit_code,omitempty"`
+	AgentSignal   string           `json:"agent_signal,omitempty"`
+}
+
+// writeTerminationMessage writes a summary of the task error, along with how it was handled.
+// This is best-effort, since it is only supplementary to the container logs and the runner API.
+func (o *Orchestrator) writeTerminationMessage(ctx context.Context, taskErr, handledErr error) {
+	path := o.config.TerminationMessagePath
+	if path == "" {
+		return
+	}
+
+	msg := terminationMessage{
+		Reason:  taskErr.Error(),
+		Class:   taskerrors.Classify(taskErr),
+		Code:    taskerrors.CodeOf(taskErr),
+		Outcome: outcomeUnreported,
+		TaskID:  o.config.TaskID,
+	}
+	if len(msg.Reason) > maxTerminationReasonLength {
+		msg.Reason = msg.Reason[:maxTerminationReasonLength] + "..."
+	}
+
+	switch {
+	case handledErr == nil:
+		msg.Outcome = outcomeRetried
+	case o.retryAction(taskErr) == RetryActionLetAgentReport:
+		msg.Outcome = outcomeLeftToAgent
+	case errors.As(handledErr, &taskerrors.HandledError{}):
+		msg.Outcome = outcomeInfraFailed
+	}
+
+	if status, ok := o.taskAgent.ExitStatus(); ok {
+		if status.Signaled() {
+			msg.AgentSignal = cmd.SignalName(status.Signal)
+		} else {
+			msg.AgentExitCode = &status.ExitCode
+		}
+	}
+
+	b, err := json.Marshal(msg)
+	if err == nil {
+		err = os.WriteFile(path, b, 0644) //nolint:gosec // the termination message isn't sensitive
+	}
+	if err != nil {
+		o11y.LogError(ctx, "failed to write termination message", err, o11y.Field("path", path))
+	}
+}